@@ -1,9 +1,12 @@
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"github.com/nyudlts/electronic-records-workflow-tool/lib"
+	"github.com/spf13/cobra"
+)
 
 func init() {
-	aipSizeCmd.Flags().BoolVarP(&directories, "directory", "d", false, "Print size info for each directory")
+	addSizeFlags(aipSizeCmd, "directory")
 	aipCmd.AddCommand(aipSizeCmd)
 }
 
@@ -11,22 +14,9 @@ var aipSizeCmd = &cobra.Command{
 	Use:   "size",
 	Short: "Get the file count and size of an AIP package",
 	Run: func(cmd *cobra.Command, args []string) {
-
-		//load the project config
-		if err := loadProjectConfig(); err != nil {
-			panic(err)
-		}
-
-		//print the total size of SIP
-		if err := getPackageSize(adocConfig.AIPLoc); err != nil {
-			panic(err)
-		}
-
-		//print the stats of each directory if flag set
-		if directories {
-			if err := printDirectoryStats(adocConfig.AIPLoc); err != nil {
-				panic(err)
-			}
+		//print the size report of the AIPs
+		if err := lib.PrintAIPPackageSize(sizeOptions); err != nil {
+			exitOnSizeError(err)
 		}
 	},
 }
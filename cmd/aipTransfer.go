@@ -2,31 +2,35 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
 
+	"github.com/nyudlts/electronic-records-workflow-tool/lib"
 	"github.com/spf13/cobra"
 )
 
+var (
+	transferOptions lib.TransferOptions
+	verifyOptions   lib.VerifyDeliveryOptions
+)
+
 func init() {
-	rstarXfrCmd.Flags().StringVar(&ersLoc, "aips-location", "aips/", "location of AIPS to transfer to r*")
+	rstarXfrCmd.Flags().StringVar(&transferOptions.AIPLoc, "aips-location", "", "location of AIPS to transfer to r* (default aip-location in config.yml)")
+	rstarXfrCmd.Flags().IntVar(&transferOptions.NumWorkers, "workers", 4, "number of files to upload in parallel")
+	rstarXfrCmd.Flags().StringVar(&transferOptions.Backend, "backend", "", "delivery backend: sftp, filesystem or rsync (default delivery-backend in config.yml, or sftp)")
 	aipCmd.AddCommand(rstarXfrCmd)
+
+	verifyDeliveryCmd.Flags().StringVar(&verifyOptions.AIPLoc, "aips-location", "", "location of the AIPS that were transferred (default aip-location in config.yml)")
+	verifyDeliveryCmd.Flags().IntVar(&verifyOptions.NumWorkers, "workers", 4, "number of files to read back in parallel")
+	verifyDeliveryCmd.Flags().StringVar(&verifyOptions.Backend, "backend", "", "delivery backend used for the transfer (default delivery-backend in config.yml, or sftp)")
+	verifyDeliveryCmd.Flags().BoolVar(&verifyOptions.RemoteChecksum, "remote-checksum", false, "run sha256sum on the delivery host instead of reading files back")
+	aipCmd.AddCommand(verifyDeliveryCmd)
 }
 
 var rstarXfrCmd = &cobra.Command{
 	Use:   "transfer",
 	Short: "Transfer processed AIPS to R*",
 	Run: func(cmd *cobra.Command, args []string) {
-		//load the project configuration
-		if err := loadProjectConfig(); err != nil {
-			panic(err)
-		}
-
-		fmt.Printf("ADOC AIP transfer %s\n", version)
-
 		//transfer the AIPS
-		if err := transferToRstar(); err != nil {
+		if err := lib.TransferAIPs(transferOptions); err != nil {
 			panic(err)
 		}
 
@@ -34,46 +38,14 @@ var rstarXfrCmd = &cobra.Command{
 	},
 }
 
-func transferToRstar() error {
-	ers, err := os.Stat(ersLoc)
-	if err != nil {
-		return err
-	}
-
-	if !ers.IsDir() {
-		return fmt.Errorf("%s is not a location", ersLoc)
-	}
-
-	directoryEntries, err := os.ReadDir(ersLoc)
-	if err != nil {
-		return err
-	}
-
-	xferLog := filepath.Join("logs", fmt.Sprintf("%s-aip-transfer.txt", adocConfig.CollectionCode))
-	_, err = os.Create(xferLog)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range directoryEntries {
-		fmt.Printf("  * transferring %s\n", entry.Name())
-		xferBag := filepath.Join(ersLoc, entry.Name())
-		xferCmd := exec.Command("rstar-scp.exp", xferBag)
-		cmdOutput, err := xferCmd.CombinedOutput()
-		if err != nil {
-			return err
-		}
-		cmdOutput = append(cmdOutput, []byte("\n")...)
-
-		f, err := os.OpenFile(xferLog, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0775)
-		if err != nil {
+var verifyDeliveryCmd = &cobra.Command{
+	Use:   "verify-delivery",
+	Short: "Verify the fixity of delivered AIPS against their manifests",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lib.VerifyDelivery(verifyOptions); err != nil {
 			panic(err)
 		}
-		defer f.Close()
 
-		if _, err = f.Write(cmdOutput); err != nil {
-			panic(err)
-		}
-	}
-	return nil
+		fmt.Println("All delivered AIPS verified")
+	},
 }
@@ -2,88 +2,32 @@ package cmd
 
 import (
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
 
-	bagit "github.com/nyudlts/go-bagit"
+	"github.com/nyudlts/electronic-records-workflow-tool/lib"
 	"github.com/spf13/cobra"
 )
 
-var full bool
+var validateOptions lib.AIPValidateOptions
 
 func init() {
-	validateERsCmd.Flags().StringVar(&ersLoc, "aips-location", "aips", "location of AIPS to validate")
-	validateERsCmd.Flags().BoolVar(&full, "full", false, "do a full validation instead of fast validation")
+	validateERsCmd.Flags().StringVar(&validateOptions.AIPLoc, "aips-location", "", "location of AIPS to validate (default aip-location in config.yml)")
+	validateERsCmd.Flags().BoolVar(&validateOptions.Full, "full", false, "do a full validation instead of fast validation")
+	validateERsCmd.Flags().IntVar(&validateOptions.NumWorkers, "workers", 4, "number of AIPS to validate in parallel")
+	validateERsCmd.Flags().StringVar(&validateOptions.AIPFileLoc, "aip-file", "", "only validate the AIPS listed in this aip-file")
+	validateERsCmd.Flags().StringVar(&validateOptions.ProfileLoc, "profile", "", "bagit profile to validate against (default bag-info-profile.bagit-profile in config.yml)")
 	aipCmd.AddCommand(validateERsCmd)
 }
 
 var validateERsCmd = &cobra.Command{
-	Use:   "validate",
-	Short: "Validate AIPS prior to transfer to R*",
+	Use:   "validate [aip ...]",
+	Short: "Validate AIPS prior to transfer to R*, all of them or only those named",
 	Run: func(cmd *cobra.Command, args []string) {
-
-		//load project config
-		if err := loadProjectConfig(); err != nil {
-			panic(err)
-		}
-
-		fmt.Printf("ADOC AIP validate %s\n", version)
+		validateOptions.AIPs = args
 
 		//validate the AIPS
-		if err := validateAIPs(); err != nil {
+		if err := lib.ValidateAIPs(validateOptions); err != nil {
 			panic(err)
 		}
 		fmt.Println("All AIPs are valid")
 	},
 }
-
-func validateAIPs() error {
-	ers, err := os.Stat(ersLoc)
-	if err != nil {
-		return err
-	}
-
-	if !ers.IsDir() {
-		return fmt.Errorf("%s is not a location", ersLoc)
-	}
-
-	logFile, err := os.Create(fmt.Sprintf("logs/%s-aip-validation.log", adocConfig.CollectionCode))
-	if err != nil {
-		return err
-	}
-
-	defer logFile.Close()
-	log.SetOutput(logFile)
-
-	directoryEntries, err := os.ReadDir(ersLoc)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range directoryEntries {
-		if entry.IsDir() {
-
-			erPath := filepath.Join(ersLoc, entry.Name())
-			bag, err := bagit.GetExistingBag(erPath)
-			if err != nil {
-				return err
-			}
-
-			if full {
-				fmt.Printf("  * validating %s\n", entry.Name())
-				if err := bag.ValidateBag(false, false); err != nil {
-					return err
-				}
-			} else {
-				fmt.Printf("  * fast validating %s\n", entry.Name())
-				if err := bag.ValidateBag(true, false); err != nil {
-					return err
-				}
-			}
-
-		}
-	}
-
-	return nil
-}
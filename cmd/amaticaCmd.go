@@ -7,7 +7,7 @@ import (
 
 func init() {
 	// Add your commands here
-	amaticaSizeCmd.Flags().BoolVarP(&directories, "directories", "d", false, "print directories")
+	addSizeFlags(amaticaSizeCmd, "directories")
 	amaticaCmd.AddCommand(amaticaSizeCmd)
 	amaticaPrepCmd.Flags().IntVar(&numWorkers, "workers", 1, "number of worker threads to process SIPs")
 	amaticaCmd.AddCommand(amaticaPrepCmd)
@@ -23,8 +23,8 @@ var amaticaCmd = &cobra.Command{
 var amaticaSizeCmd = &cobra.Command{
 	Use: "size",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := lib.PrintXferPackageSize(directories); err != nil {
-			panic(err)
+		if err := lib.PrintXferPackageSize(sizeOptions); err != nil {
+			exitOnSizeError(err)
 		}
 	},
 }
@@ -1,83 +1,25 @@
 package cmd
 
 import (
-	"fmt"
-
-	amatica "github.com/nyudlts/go-archivematica"
+	"github.com/nyudlts/electronic-records-workflow-tool/lib"
 	"github.com/spf13/cobra"
 )
 
-var ingests bool
-var transfers bool
+var amaticaClearOptions lib.AmaticaClearOptions
 
 func init() {
-	clrCmd.Flags().StringVar(&amaticaConfigLoc, "config", "", "")
-	clrCmd.Flags().BoolVar(&ingests, "ingests", false, "")
-	clrCmd.Flags().BoolVar(&transfers, "transfers", false, "")
+	clrCmd.Flags().StringVar(&amaticaClearOptions.ConfigLoc, "config", "", "go-archivematica config (default archivematica-config in config.yml, or go-archivematica.yml in the user config directory)")
+	clrCmd.Flags().BoolVar(&amaticaClearOptions.Ingests, "ingests", false, "clear completed ingests")
+	clrCmd.Flags().BoolVar(&amaticaClearOptions.Transfers, "transfers", false, "clear completed transfers")
 	amaticaCmd.AddCommand(clrCmd)
 }
 
 var clrCmd = &cobra.Command{
-	Use: "clear",
+	Use:   "clear",
+	Short: "Clear completed transfers and ingests from Archivematica",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := checkFlags(); err != nil {
-			panic(err)
-		}
-
-		if err := clear(); err != nil {
+		if err := lib.ClearAmatica(amaticaClearOptions); err != nil {
 			panic(err)
 		}
 	},
 }
-
-func clear() error {
-
-	var err error
-	client, err = amatica.NewAMClient(amaticaConfigLoc, 20)
-	if err != nil {
-		return err
-	}
-
-	if transfers {
-		fmt.Println("Clearing completed transfers")
-		completedTransfers, err := client.GetCompletedTransfers()
-		if err != nil {
-			return err
-		}
-
-		completedTransfersMap, err := client.GetCompletedTransfersMap(completedTransfers)
-		if err != nil {
-			return err
-		}
-
-		for k, v := range completedTransfersMap {
-			fmt.Printf("clearing %s: %s\n", k, v.Name)
-			if err := client.DeleteTransfer(v.UUID); err != nil {
-				return err
-			}
-			fmt.Printf("%s: %s cleared\n", k, v.Name)
-		}
-	}
-
-	if ingests {
-		completedIngests, err := client.GetCompletedIngests()
-		if err != nil {
-			return err
-		}
-
-		completedIngestsMap, err := client.GetCompletedIngestsMap(completedIngests)
-		if err != nil {
-			return err
-		}
-
-		for k, v := range completedIngestsMap {
-			fmt.Printf("clearing %s: %s\n", k, v.Name)
-			if err := client.DeleteIngest(v.UUID); err != nil {
-				return err
-			}
-			fmt.Printf("%s: %s cleared\n", k, v.Name)
-		}
-	}
-
-	return nil
-}
@@ -5,8 +5,32 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	matchSIP        bool
+	workOrderOutput string
+	dryRun          bool
+	aspaceOptions   lib.AspaceOptions
+	rateLimit       int
+	updateOptions   lib.AspaceUpdateOptions
+)
+
 func init() {
+	aspaceCmd.PersistentFlags().StringVar(&aspaceOptions.ConfigLoc, "config", "", "go-aspace config file (default `aspace-config` in config.yml or go-aspace.yml in the user config directory)")
+	aspaceCmd.PersistentFlags().StringVar(&aspaceOptions.Environment, "environment", "", "environment in the go-aspace config (default `aspace-environment` in config.yml or prod)")
+	aspaceCmd.PersistentFlags().StringVar(&aspaceOptions.StaffURL, "staff-url", "", "base url of the ArchivesSpace staff interface (default `aspace-staff-url` in config.yml or https://archivesspace.library.nyu.edu)")
+	aspaceCmd.PersistentFlags().StringVar(&aspaceOptions.PublicURL, "public-url", "", "base url of the ArchivesSpace public interface (default `aspace-public-url` in config.yml)")
+	aspaceCheckCmd.Flags().IntVar(&numWorkers, "workers", 1, "number of worker threads to check work order rows")
+	aspaceCheckCmd.Flags().IntVar(&rateLimit, "rps", 0, "maximum number of requests per second to ArchivesSpace, 0 for no limit")
 	aspaceCmd.AddCommand(aspaceCheckCmd)
+	aspaceWorkOrderCmd.Flags().BoolVar(&matchSIP, "match-sip", false, "select archival objects whose component ids match ER directories in the SIP")
+	aspaceWorkOrderCmd.Flags().StringVarP(&workOrderOutput, "output", "o", "", "location to write the work order (default sip/metadata/<collection-code>_aspace_wo.tsv)")
+	aspaceCmd.AddCommand(aspaceWorkOrderCmd)
+	aspaceCreateDOsCmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the digital objects that would be created without creating them")
+	aspaceCmd.AddCommand(aspaceCreateDOsCmd)
+	aspaceUpdateCmd.Flags().StringVar(&updateOptions.AIPFileLoc, "aip-file", "", "the location of the aip-file containing aips to process (default finds aipfile in logs directory)")
+	aspaceUpdateCmd.Flags().StringVar(&updateOptions.URIPattern, "uri-pattern", "", "R* uri pattern for file versions, supports {component-id}, {aip-uuid}, {collection-code} and {rstar-collection-id} (default `rstar-uri-pattern` in config.yml)")
+	aspaceUpdateCmd.Flags().BoolVar(&updateOptions.DryRun, "dry-run", false, "list the changes without updating ArchivesSpace")
+	aspaceCmd.AddCommand(aspaceUpdateCmd)
 	rootCmd.AddCommand(aspaceCmd)
 }
 
@@ -19,7 +43,37 @@ var aspaceCheckCmd = &cobra.Command{
 	Use:   "check",
 	Short: "Check that DOs exist in ArchivesSpace",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := lib.AspaceCheck(); err != nil {
+		if err := lib.AspaceCheck(aspaceOptions, numWorkers, rateLimit); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var aspaceWorkOrderCmd = &cobra.Command{
+	Use:   "workorder",
+	Short: "Generate a work order from the resource in transfer-info.txt",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lib.AspaceWorkOrder(aspaceOptions, matchSIP, workOrderOutput); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var aspaceCreateDOsCmd = &cobra.Command{
+	Use:   "create-dos",
+	Short: "Create and link missing DOs for work order rows in ArchivesSpace",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lib.AspaceCreateDOs(aspaceOptions, dryRun); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var aspaceUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Add R* file versions and extents to ArchivesSpace after ingest",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lib.AspaceUpdate(aspaceOptions, updateOptions); err != nil {
 			panic(err)
 		}
 	},
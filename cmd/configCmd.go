@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/nyudlts/electronic-records-workflow-tool/lib"
+	"github.com/spf13/cobra"
+)
+
+var configShowOptions lib.ConfigShowOptions
+
+func init() {
+	configShowCmd.Flags().BoolVar(&configShowOptions.Effective, "effective", false, "show the config merged from the defaults, site, user and project configs and ERWT_* environment variables, with the source of each value")
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "ewt config commands",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the project config",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lib.ShowConfig(configShowOptions); err != nil {
+			panic(err)
+		}
+	},
+}
@@ -1,38 +1,27 @@
 package cmd
 
 import (
-	"embed"
-	"encoding/json"
 	"fmt"
 	"os"
 
+	"github.com/nyudlts/electronic-records-workflow-tool/lib"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
 )
 
-//go:embed adoc-config.yml
-var vfs embed.FS
-
 var rootCmd = &cobra.Command{}
 
-const version = "v1.0.0"
-const VERSION = "v1.1.0"
+func init() {
+	rootCmd.PersistentFlags().StringVar(&project, "project", "", "project directory to run in (default ERWT_PROJECT or the first config.yml found searching up from the working directory)")
+	cobra.OnInitialize(func() { lib.SetProject(project) })
+}
 
 // common flags
 var (
-	aipLoc           string
-	aipFileLoc       string
-	sourceLoc        string
-	stagingLoc       string
-	tmpLoc           string
-	amaticaConfigLoc string
-	ersLoc           string
-	pollTime         int
-	collectionCode   string
-	adocConfig       *AdocConfig
-	projectLoc       string
-	profile          string
-	numWorkers       int
+	aipLoc     string
+	tmpLoc     string
+	profile    string
+	numWorkers int
+	project    string
 )
 
 func Execute() {
@@ -41,27 +30,3 @@ func Execute() {
 		os.Exit(1)
 	}
 }
-
-func loadProjectConfig() error {
-	//read the adoc-config
-	b, err := os.ReadFile("config.yml")
-	if err != nil {
-		return err
-	}
-
-	//unmarshal to config options
-	if err := yaml.Unmarshal(b, &adocConfig); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func printConfig() error {
-	b, err := json.MarshalIndent(adocConfig, "", "  ")
-	if err != nil {
-		return err
-	}
-	fmt.Println(string(b))
-	return nil
-}
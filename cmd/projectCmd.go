@@ -3,14 +3,42 @@ package cmd
 import (
 	"github.com/nyudlts/electronic-records-workflow-tool/lib"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	initOptions        lib.InitOptions
+	archiveOptions     lib.ArchiveOptions
+	restoreDestination string
 )
 
 func init() {
-	projectInitCmd.Flags().StringVarP(&collectionCode, "collection-code", "c", "", "the collection code to use for adoc")
-	projectInitCmd.Flags().StringVarP(&sourceLoc, "source-location", "s", "", "the source location for the collection")
+	projectInitCmd.Flags().StringVarP(&initOptions.CollectionCode, "collection-code", "c", "", "the collection code to use for adoc, <partner-code>_<collection-id>")
+	projectInitCmd.Flags().StringVarP(&initOptions.SourceLoc, "source-location", "s", "", "the source location for the collection")
+	projectInitCmd.Flags().StringVar(&initOptions.PartnerCode, "partner", "", "the partner whose project template to use: fales, tamwag or nyuarchives (default the prefix of the collection code)")
+	projectInitCmd.Flags().StringVar(&initOptions.TransferSource, "transfer-source", "", "the archivematica transfer source, required unless the partner's project template sets one")
+	projectInitCmd.Flags().StringVar(&initOptions.WorkOrderLoc, "work-order", "", "work order to copy to sip/metadata")
+	projectInitCmd.Flags().StringVar(&initOptions.TransferInfoLoc, "transfer-info", "", "transfer-info.txt to copy to sip/metadata")
+	projectInitCmd.Flags().BoolVar(&initOptions.Update, "update", false, "repair an existing project, creating missing directories and adding missing config keys")
+	//--force is the old name of --update
+	projectInitCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "force" {
+			name = "update"
+		}
+		return pflag.NormalizedName(name)
+	})
 	projectCmd.AddCommand(projectInitCmd)
-	projectArchiveCmd.Flags().StringVarP(&projectLoc, "project-location", "p", "", "Project name")
+	projectArchiveCmd.Flags().StringVarP(&archiveOptions.ProjectLoc, "project-location", "p", "", "location of the project to archive (default the current project)")
+	projectArchiveCmd.Flags().StringVar(&archiveOptions.ArchiveLoc, "archive-location", "", "location to write the archive (default archive-location in the project's config.yml or completed alongside the project)")
+	projectArchiveCmd.Flags().BoolVar(&archiveOptions.Force, "force", false, "archive the project even if it does not reconcile as complete or holds files that can not be archived")
 	projectCmd.AddCommand(projectArchiveCmd)
+	projectRestoreCmd.Flags().StringVarP(&restoreDestination, "destination", "d", ".", "directory to restore the project into")
+	projectRestoreCmd.Flags().StringVar(&archiveOptions.ArchiveLoc, "archive-location", "", "location of archived projects (default archive-location in the project's config.yml or completed alongside the project)")
+	projectCmd.AddCommand(projectRestoreCmd)
+	projectListArchivedCmd.Flags().StringVar(&archiveOptions.ArchiveLoc, "archive-location", "", "location of archived projects (default archive-location in the project's config.yml or completed alongside the project)")
+	projectCmd.AddCommand(projectListArchivedCmd)
+	projectCmd.AddCommand(projectReconcileCmd)
+	projectCmd.AddCommand(projectCompareCmd)
 	rootCmd.AddCommand(projectCmd)
 }
 
@@ -24,7 +52,7 @@ var projectInitCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize a EWT project",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := lib.InitProject(collectionCode, sourceLoc); err != nil {
+		if err := lib.InitProject(initOptions); err != nil {
 			panic(err)
 		}
 	},
@@ -34,7 +62,48 @@ var projectArchiveCmd = &cobra.Command{
 	Use:   "archive",
 	Short: "Archive a EWT Project",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := lib.ArchiveProject(projectLoc); err != nil {
+		if err := lib.ArchiveProject(archiveOptions); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var projectRestoreCmd = &cobra.Command{
+	Use:   "restore <archive>",
+	Short: "Restore an archived EWT project, given the path to its archive or its name in the archive location",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lib.RestoreProject(args[0], restoreDestination, archiveOptions.ArchiveLoc); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var projectListArchivedCmd = &cobra.Command{
+	Use:   "list-archived",
+	Short: "List the archived EWT projects with the dates they were archived and their sizes",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lib.ListArchivedProjects(archiveOptions.ArchiveLoc); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var projectReconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Follow each component id in the work order through to its delivery to R*",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lib.ReconcileProject(); err != nil {
+			panic(err)
+		}
+	},
+}
+
+var projectCompareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare the file counts and sizes of each ER across source, sip, xfer and aips",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lib.CompareProject(); err != nil {
 			panic(err)
 		}
 	},
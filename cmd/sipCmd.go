@@ -15,7 +15,7 @@ func init() {
 	sipCmd.AddCommand(sipValidateCmd)
 	sipScanCmd.AddCommand(sipScanAVCmd)
 	sipCmd.AddCommand(sipScanCmd)
-	sipSizeCmd.Flags().BoolVarP(&directories, "directories", "d", false, "print directories")
+	addSizeFlags(sipSizeCmd, "directories")
 	sipCmd.AddCommand(sipSizeCmd)
 	rootCmd.AddCommand(sipCmd)
 
@@ -35,8 +35,8 @@ var sipSizeCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 
 		//print the total size of source directory
-		if err := lib.PrintSIPPackageSize(directories); err != nil {
-			panic(err)
+		if err := lib.PrintSIPPackageSize(sizeOptions); err != nil {
+			exitOnSizeError(err)
 		}
 	},
 }
@@ -1,75 +1,30 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
-	"sort"
 
-	"github.com/nyudlts/bytemath"
+	"github.com/nyudlts/electronic-records-workflow-tool/lib"
+	"github.com/spf13/cobra"
 )
 
-var directories bool
+var sizeOptions lib.SizeOptions
 
-type DirectoryStats struct {
-	Name           string
-	Size           int64
-	NumFiles       int
-	NumDirectories int
+// addSizeFlags adds the flags shared by the size commands, directoryFlag keeps each command's existing flag name
+func addSizeFlags(cmd *cobra.Command, directoryFlag string) {
+	cmd.Flags().BoolVarP(&sizeOptions.Directories, directoryFlag, "d", false, "Print size info for each directory")
+	cmd.Flags().StringVar(&sizeOptions.Format, "format", "text", "output format: text, json or csv")
+	cmd.Flags().IntVar(&sizeOptions.NumLargest, "largest", 10, "number of largest files to list")
+	cmd.Flags().StringVarP(&sizeOptions.OutputLoc, "output", "o", "", "file to write the report to instead of stdout")
 }
 
-func printDirectoryStats(pkgPath string) error {
-	directoryStats := []DirectoryStats{}
-	dirs, err := os.ReadDir(pkgPath)
-	if err != nil {
-		return err
+// exitOnSizeError exits non-zero when the report lists entries that could not be read, which are not worth a stack
+// trace after the report, and panics on any other error
+func exitOnSizeError(err error) {
+	if errors.Is(err, lib.ErrUnreadableEntries) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-
-	for _, dir := range dirs {
-		ds := DirectoryStats{dir.Name(), 0, 0, 0}
-		if err := filepath.Walk(filepath.Join(pkgPath, dir.Name()), func(path string, info os.FileInfo, err error) error {
-			if info.IsDir() {
-				ds.NumDirectories++
-			} else {
-				ds.NumFiles++
-				ds.Size += info.Size()
-			}
-			return nil
-		}); err != nil {
-			return err
-		}
-		directoryStats = append(directoryStats, ds)
-	}
-
-	sort.Slice(directoryStats, func(i, j int) bool {
-		return directoryStats[i].Size > directoryStats[j].Size
-	})
-
-	for _, ds := range directoryStats {
-		fmt.Printf("  * %s: %d files in %d directories, %s\n", ds.Name, ds.NumFiles, ds.NumDirectories, bytemath.ConvertBytesToHumanReadable(ds.Size))
-	}
-
-	return nil
-
-}
-
-func getPackageSize(pkgPath string) error {
-	numFiles := 0
-	numDirectories := 0
-	sizeFiles := int64(0)
-
-	if err := filepath.Walk(pkgPath, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			numDirectories++
-		} else {
-			numFiles++
-			sizeFiles += info.Size()
-		}
-		return nil
-	}); err != nil {
-		return err
-	}
-
-	fmt.Printf("%s: %d files in %d directories, %s\n", pkgPath, numFiles, numDirectories, bytemath.ConvertBytesToHumanReadable(sizeFiles))
-	return nil
+	panic(err)
 }
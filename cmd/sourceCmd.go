@@ -6,7 +6,7 @@ import (
 )
 
 func init() {
-	sourceSizeCmd.Flags().BoolVarP(&directories, "directory", "d", false, "Print size info for each directory")
+	addSizeFlags(sourceSizeCmd, "directory")
 	sourceCmd.AddCommand(sourceSizeCmd)
 	sourceCmd.AddCommand(sourceXferCmd)
 	rootCmd.AddCommand(sourceCmd)
@@ -33,8 +33,8 @@ var sourceSizeCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 
 		//print the total size of source directory
-		if err := lib.PrintSourcePackageSize(directories); err != nil {
-			panic(err)
+		if err := lib.PrintSourcePackageSize(sizeOptions); err != nil {
+			exitOnSizeError(err)
 		}
 	},
 }
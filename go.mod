@@ -8,11 +8,15 @@ require (
 	github.com/nyudlts/go-archivematica v0.0.0-20240311191358-336699047a44
 	github.com/nyudlts/go-aspace v0.6.2-0.20240729183828-51b02243b270
 	github.com/nyudlts/go-bagit v0.3.0-alpha
+	github.com/pkg/sftp v1.13.7
 	github.com/spf13/cobra v1.8.1
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/crypto v0.31.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
@@ -0,0 +1,460 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bagit "github.com/nyudlts/go-bagit"
+)
+
+// AIPPrepOptions holds the settings for `aip prep`
+type AIPPrepOptions struct {
+	AIPFileLoc string
+	StagingLoc string
+	TmpLoc     string
+	NumWorkers int
+}
+
+type prepResult struct {
+	AIP           string
+	StagedLoc     string
+	FilesVerified int
+	Duration      time.Duration
+	RolledBack    bool
+	Err           error
+}
+
+// tagFileBackup holds per-bag copies of the tag files rewritten by prep, so a failed prep can be undone
+type tagFileBackup struct {
+	bagLocation string
+	backups     map[string]string
+	newFiles    []string
+}
+
+var (
+	woMatcher    = regexp.MustCompile("aspace_wo.tsv$")
+	tiMatcher    = regexp.MustCompile("transfer-info.txt")
+	prepTagFiles = []string{"bag-info.txt", "tagmanifest-sha256.txt"}
+)
+
+func PrepAIPs(opts AIPPrepOptions) error {
+	fmt.Printf("ewt aip prep, %s\n", VERSION)
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	aipFileLoc := opts.AIPFileLoc
+	if aipFileLoc == "" {
+		var err error
+		aipFileLoc, err = findAIPFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	aipLocations, err := readAIPFile(aipFileLoc)
+	if err != nil {
+		return err
+	}
+
+	profile, err := getBagInfoProfile()
+	if err != nil {
+		return err
+	}
+
+	if opts.NumWorkers < 1 {
+		opts.NumWorkers = 1
+	}
+
+	opts.StagingLoc = firstNonEmpty(opts.StagingLoc, config.AIPLoc)
+	opts.TmpLoc = firstNonEmpty(opts.TmpLoc, config.LogLoc)
+
+	for _, dir := range []string{opts.StagingLoc, opts.TmpLoc} {
+		if err := os.MkdirAll(dir, 0775); err != nil {
+			return err
+		}
+	}
+
+	//create a logger
+	logFile, err := os.Create(currentProject().LogLoc("aip-prep.log"))
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	log.SetOutput(logFile)
+	log.Printf("[INFO] ewt aip prep %s, preparing %d aips with %d workers\n", VERSION, len(aipLocations), opts.NumWorkers)
+	fmt.Printf("  * preparing %d aips from %s with %d workers\n", len(aipLocations), aipFileLoc, opts.NumWorkers)
+
+	//prep the aips on a pool of workers
+	aipChan := make(chan string)
+	resultChan := make(chan prepResult)
+	wg := sync.WaitGroup{}
+	for i := 0; i < opts.NumWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for aipLocation := range aipChan {
+				resultChan <- prepAIP(aipLocation, opts.StagingLoc, opts.TmpLoc, profile)
+			}
+		}()
+	}
+
+	go func() {
+		for _, aipLocation := range aipLocations {
+			aipChan <- aipLocation
+		}
+		close(aipChan)
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	results := map[string]prepResult{}
+	numFailed := 0
+	for result := range resultChan {
+		results[result.AIP] = result
+		if result.Err == nil {
+			fmt.Printf("  * %s: OK in %s\n", result.AIP, result.Duration.Round(time.Second))
+			continue
+		}
+
+		numFailed++
+		msg := fmt.Sprintf("  * %s: FAILED, %s", result.AIP, result.Err.Error())
+		if result.RolledBack {
+			msg += ", bag-info.txt and tagmanifest-sha256.txt restored"
+		}
+		fmt.Println(msg)
+	}
+
+	//write the results in the order of the aip-file
+	resultsLoc := currentProject().LogLoc("aip-prep.tsv")
+	if err := writePrepResults(resultsLoc, aipLocations, results); err != nil {
+		return err
+	}
+	fmt.Printf("  * results written to %s\n", resultsLoc)
+
+	if numFailed > 0 {
+		return fmt.Errorf("%d of %d aips failed to prep", numFailed, len(aipLocations))
+	}
+
+	return nil
+}
+
+// PrepSingleAIP updates a single staged AIP in place, logging each step to stdout
+func PrepSingleAIP(aipLocation string, tmpLocation string) error {
+	fmt.Printf("ewt aip prep-single, %s\n", VERSION)
+	fmt.Printf("  * prepping bag at %s for transfer to R*\n", aipLocation)
+
+	for _, dir := range []string{aipLocation, tmpLocation} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+
+	//the bag-info profile is only applied when prepping from a project directory
+	var profile *BagItProfile
+	if _, err := FindConfig(); err == nil {
+		if err := loadConfig(); err != nil {
+			return err
+		}
+
+		profile, err = getBagInfoProfile()
+		if err != nil {
+			return err
+		}
+	}
+
+	log.SetOutput(os.Stdout)
+	if _, err := prepPackage(aipLocation, tmpLocation, false, profile); err != nil {
+		return err
+	}
+
+	fmt.Println("Package preparation complete")
+	return nil
+}
+
+func readAIPFile(aipFileLoc string) ([]string, error) {
+	aipFile, err := os.Open(aipFileLoc)
+	if err != nil {
+		return nil, err
+	}
+	defer aipFile.Close()
+
+	aipLocations := []string{}
+	scanner := bufio.NewScanner(aipFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			aipLocations = append(aipLocations, line)
+		}
+	}
+
+	return aipLocations, scanner.Err()
+}
+
+// prepAIP stages an AIP from the AIP store, verifying it against its manifests, and preps the staged copy
+func prepAIP(aipLocation string, stagingLoc string, tmpLoc string, profile *BagItProfile) prepResult {
+	start := time.Now()
+	name := getAIPName(aipLocation)
+	result := prepResult{AIP: name}
+
+	if _, err := os.Stat(aipLocation); err != nil {
+		result.Err = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	//copy the aip to the staging area
+	stagedLoc, filesVerified, err := stageAIP(aipLocation, stagingLoc)
+	if err != nil {
+		result.Err = fmt.Errorf("staging failed: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+	result.StagedLoc = stagedLoc
+	result.FilesVerified = filesVerified
+
+	log.Printf("[INFO] %s: updating package at %s\n", name, result.StagedLoc)
+	result.RolledBack, result.Err = prepPackage(result.StagedLoc, tmpLoc, true, profile)
+	result.Duration = time.Since(start)
+	return result
+}
+
+// prepPackage merges transfer-info.txt into bag-info.txt and moves the work order to the bag's root; the
+// original tag files are backed up first and restored if any step fails, which is reported by rolledBack.
+// verified skips validating the bag before it is updated, for bags checked against their manifests when staged,
+// and a non-nil profile is checked against the updated bag-info.txt before it is written.
+func prepPackage(bagLocation string, tmpLocation string, verified bool, profile *BagItProfile) (rolledBack bool, err error) {
+	name := filepath.Base(bagLocation)
+
+	//backup the tag files
+	backup, err := backupTagFiles(bagLocation, tmpLocation)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("[INFO] %s: backed up bag-info.txt and tagmanifest-sha256.txt to %s\n", name, tmpLocation)
+
+	defer func() {
+		if err == nil {
+			if removeErr := backup.remove(); removeErr != nil {
+				log.Printf("[WARNING] %s: could not remove tag file backups: %s\n", name, removeErr.Error())
+			}
+			return
+		}
+
+		log.Printf("[ERROR] %s: %s, restoring tag files\n", name, err.Error())
+		if restoreErr := backup.restore(); restoreErr != nil {
+			err = fmt.Errorf("%w, and restoring the tag files from %s failed: %s", err, tmpLocation, restoreErr.Error())
+			return
+		}
+		rolledBack = true
+		log.Printf("[INFO] %s: restored bag-info.txt and tagmanifest-sha256.txt\n", name)
+	}()
+
+	bag, err := bagit.GetExistingBag(bagLocation)
+	if err != nil {
+		return false, err
+	}
+
+	//validate the bag, unless it was verified when it was staged
+	if !verified {
+		log.Printf("[INFO] %s: validating bag\n", name)
+		if err := bag.ValidateBag(false, false); err != nil {
+			return false, err
+		}
+	}
+
+	//locate the workorder
+	matches := bag.Payload.FindFilesInPayload(woMatcher)
+	if len(matches) != 1 {
+		return false, fmt.Errorf("no workorder found")
+	}
+	woPath := matches[0].Path
+
+	//move the workorder to the root of the bag
+	log.Printf("[INFO] %s: moving work order to bag's root\n", name)
+	backup.trackNewFile(filepath.Join(bagLocation, filepath.Base(woPath)))
+	if err := bag.AddFileToBagRoot(woPath); err != nil {
+		return false, err
+	}
+
+	//locate transfer-info.txt
+	matches = bag.Payload.FindFilesInPayload(tiMatcher)
+	if len(matches) != 1 {
+		return false, fmt.Errorf("no transfer-info.txt found")
+	}
+	tiPath := strings.ReplaceAll(matches[0].Path+"/", bagLocation, "")
+
+	//create a tag set from transfer-info.txt
+	log.Printf("[INFO] %s: creating new tag set from transfer-info.txt\n", name)
+	transferInfo, err := bagit.NewTagSet(tiPath, bagLocation)
+	if err != nil {
+		return false, err
+	}
+
+	//add the hostname and the bag's path to the tag set
+	hostname, err := os.Hostname()
+	if err != nil {
+		return false, err
+	}
+	transferInfo.Tags["nyu-dl-hostname"] = hostname
+
+	path, err := filepath.Abs(bagLocation)
+	if err != nil {
+		return false, err
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, err
+	}
+	transferInfo.Tags["nyu-dl-pathname"] = path
+
+	//merge the tag sets and rewrite bag-info.txt
+	log.Printf("[INFO] %s: merging transfer-info.txt into bag-info.txt\n", name)
+	bagInfo, err := bagit.NewTagSet("bag-info.txt", bagLocation)
+	if err != nil {
+		return false, err
+	}
+	bagInfo.AddTags(transferInfo.Tags)
+
+	//add the computed tags from the project's bag-info profile
+	computed, err := getComputedTags(preppedBag{Location: bagLocation, WorkOrderLoc: woPath})
+	if err != nil {
+		return false, err
+	}
+	if len(computed) > 0 {
+		log.Printf("[INFO] %s: adding computed tags to bag-info.txt\n", name)
+		bagInfo.AddTags(computed)
+	}
+
+	//check bag-info.txt against the project's bagit profile
+	if profile != nil {
+		log.Printf("[INFO] %s: checking bag-info.txt against the bagit profile\n", name)
+		tags := map[string][]string{}
+		for tag, value := range bagInfo.Tags {
+			tags[tag] = []string{value}
+		}
+		if problems := profile.checkBagInfo(tags); len(problems) > 0 {
+			return false, fmt.Errorf("bag-info.txt does not meet the bagit profile: %s", strings.Join(problems, "; "))
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(bagLocation, "bag-info.txt"), bagInfo.GetTagSetAsByteSlice(), 0664); err != nil {
+		return false, err
+	}
+
+	//update the checksum for bag-info.txt in tagmanifest-sha256.txt
+	log.Printf("[INFO] %s: updating checksum for bag-info.txt in tagmanifest-sha256.txt\n", name)
+	tagManifest, err := bagit.NewManifest(bagLocation, "tagmanifest-sha256.txt")
+	if err != nil {
+		return false, err
+	}
+
+	if err := tagManifest.UpdateManifest("bag-info.txt"); err != nil {
+		return false, err
+	}
+
+	if err := tagManifest.Serialize(); err != nil {
+		return false, err
+	}
+
+	//validate the updated bag
+	log.Printf("[INFO] %s: validating the updated bag\n", name)
+	if err := bag.ValidateBag(false, false); err != nil {
+		return false, err
+	}
+
+	log.Printf("[INFO] %s: package preparation complete\n", name)
+	return false, nil
+}
+
+// backupTagFiles copies a bag's tag files to `<tmp>/<bag>-<tag file>`
+func backupTagFiles(bagLocation string, tmpLocation string) (*tagFileBackup, error) {
+	backup := &tagFileBackup{bagLocation: bagLocation, backups: map[string]string{}}
+	for _, tagFile := range prepTagFiles {
+		backupLoc := filepath.Join(tmpLocation, fmt.Sprintf("%s-%s", filepath.Base(bagLocation), tagFile))
+		if _, err := copyFile(filepath.Join(bagLocation, tagFile), backupLoc); err != nil {
+			backup.remove()
+			return nil, fmt.Errorf("could not backup %s: %w", tagFile, err)
+		}
+		backup.backups[tagFile] = backupLoc
+	}
+	return backup, nil
+}
+
+// trackNewFile records a file that prep is about to add, so it is removed on restore if it did not exist before
+func (t *tagFileBackup) trackNewFile(p string) {
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		t.newFiles = append(t.newFiles, p)
+	}
+}
+
+func (t *tagFileBackup) restore() error {
+	for tagFile, backupLoc := range t.backups {
+		if _, err := copyFile(backupLoc, filepath.Join(t.bagLocation, tagFile)); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range t.newFiles {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return t.remove()
+}
+
+func (t *tagFileBackup) remove() error {
+	for _, backupLoc := range t.backups {
+		if err := os.Remove(backupLoc); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePrepResults(resultsLoc string, aipLocations []string, results map[string]prepResult) error {
+	resultsFile, err := os.Create(resultsLoc)
+	if err != nil {
+		return err
+	}
+	defer resultsFile.Close()
+
+	writer := csv.NewWriter(resultsFile)
+	writer.Comma = '\t'
+	writer.Write([]string{"aip", "aip_location", "staged_location", "files_verified", "status", "rolled_back", "duration_ms", "error"})
+	for _, aipLocation := range aipLocations {
+		result := results[getAIPName(aipLocation)]
+		status, errMsg := "OK", ""
+		if result.Err != nil {
+			status, errMsg = "FAILED", result.Err.Error()
+		}
+		writer.Write([]string{
+			result.AIP,
+			aipLocation,
+			result.StagedLoc,
+			strconv.Itoa(result.FilesVerified),
+			status,
+			strconv.FormatBool(result.RolledBack),
+			strconv.FormatInt(result.Duration.Milliseconds(), 10),
+			errMsg,
+		})
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,323 @@
+package lib
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// compressed AIP formats written by Archivematica, by file extension
+var compressedAIPExts = []string{".7z", ".tar.gz", ".tgz"}
+
+// getAIPName returns the name of an AIP from its location in the AIP store, without any compression extension
+func getAIPName(aipLocation string) string {
+	name := filepath.Base(aipLocation)
+	for _, ext := range compressedAIPExts {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// stageAIP copies or extracts an AIP into the staging location, hashing every file as it is written, and then checks
+// the hashes against the bag's manifests; the staged copy is removed if any step fails. It returns the staged location
+// and the number of files verified.
+func stageAIP(aipLocation string, stagingLoc string) (string, int, error) {
+	name := getAIPName(aipLocation)
+	stagedLoc := filepath.Join(stagingLoc, name)
+	if _, err := os.Stat(stagedLoc); err == nil {
+		return "", 0, fmt.Errorf("%s already exists in the staging location", name)
+	} else if !os.IsNotExist(err) {
+		return "", 0, err
+	}
+
+	var sums map[string]string
+	var err error
+	switch {
+	case strings.HasSuffix(aipLocation, ".7z"):
+		log.Printf("[INFO] %s: extracting 7z archive %s to %s\n", name, aipLocation, stagingLoc)
+		sums, err = extract7z(aipLocation, stagingLoc, stagedLoc)
+	case strings.HasSuffix(aipLocation, ".tar.gz"), strings.HasSuffix(aipLocation, ".tgz"):
+		log.Printf("[INFO] %s: extracting tar.gz archive %s to %s\n", name, aipLocation, stagingLoc)
+		sums, err = extractTarGz(aipLocation, name, stagedLoc)
+	default:
+		log.Printf("[INFO] %s: copying package from %s to %s\n", name, aipLocation, stagingLoc)
+		sums, err = copyAIPDir(aipLocation, stagedLoc)
+	}
+
+	if err == nil {
+		log.Printf("[INFO] %s: verifying %d staged files against the bag's manifests\n", name, len(sums))
+		err = verifyStagedAIP(name, stagedLoc, sums)
+	}
+
+	if err != nil {
+		if removeErr := os.RemoveAll(stagedLoc); removeErr != nil {
+			log.Printf("[WARNING] %s: could not remove the staged copy: %s\n", name, removeErr.Error())
+		}
+		return "", 0, err
+	}
+
+	return stagedLoc, len(sums), nil
+}
+
+// copyAIPDir copies an uncompressed AIP, returning the sha256 of each file keyed by its path in the bag
+func copyAIPDir(aipLocation string, stagedLoc string) (map[string]string, error) {
+	sums := map[string]string{}
+	err := filepath.WalkDir(aipLocation, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(aipLocation, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(stagedLoc, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0775)
+		case info.Mode().IsRegular():
+			source, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer source.Close()
+
+			sum, err := writeAndHash(target, source, info.Mode().Perm(), info.ModTime())
+			if err != nil {
+				return err
+			}
+			sums[filepath.ToSlash(rel)] = sum
+			return nil
+		default:
+			return fmt.Errorf("%s is not a regular file", p)
+		}
+	})
+
+	return sums, err
+}
+
+// extractTarGz extracts an AIP from a tar.gz archive, whose entries must all sit under a directory named for the AIP
+func extractTarGz(aipLocation string, name string, stagedLoc string) (map[string]string, error) {
+	archive, err := os.Open(aipLocation)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	sums := map[string]string{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if entry == name {
+			continue
+		}
+
+		rel, found := strings.CutPrefix(entry, name+"/")
+		if !found || !filepath.IsLocal(rel) {
+			return nil, fmt.Errorf("%s contains %s, outside of %s/", aipLocation, header.Name, name)
+		}
+		target := filepath.Join(stagedLoc, filepath.FromSlash(rel))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0775); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0775); err != nil {
+				return nil, err
+			}
+
+			sum, err := writeAndHash(target, tarReader, header.FileInfo().Mode().Perm(), header.ModTime)
+			if err != nil {
+				return nil, err
+			}
+			sums[rel] = sum
+		default:
+			return nil, fmt.Errorf("%s contains %s, which is not a regular file or directory", aipLocation, header.Name)
+		}
+	}
+
+	return sums, nil
+}
+
+// extract7z extracts an AIP from a 7z archive with the 7z command into its own directory under the staging location,
+// so that workers extracting in parallel can not overwrite each other, then moves it into place and hashes the
+// extracted files
+func extract7z(aipLocation string, stagingLoc string, stagedLoc string) (map[string]string, error) {
+	sevenZip, err := exec.LookPath("7z")
+	if err != nil {
+		return nil, fmt.Errorf("7z is required to extract %s: %w", aipLocation, err)
+	}
+
+	name := filepath.Base(stagedLoc)
+	extractLoc, err := os.MkdirTemp(stagingLoc, "."+name+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(extractLoc)
+
+	b, err := exec.Command(sevenZip, "x", "-y", "-o"+extractLoc, aipLocation).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("7z failed to extract %s: %w\n%s", aipLocation, err, string(b))
+	}
+
+	//the archive must hold the AIP's directory and nothing else
+	entries, err := os.ReadDir(extractLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) != 1 || entries[0].Name() != name || !entries[0].IsDir() {
+		found := []string{}
+		for _, entry := range entries {
+			found = append(found, entry.Name())
+		}
+		return nil, fmt.Errorf("%s extracted %s, expected only %s/", aipLocation, strings.Join(found, ", "), name)
+	}
+
+	if err := os.Rename(filepath.Join(extractLoc, name), stagedLoc); err != nil {
+		return nil, err
+	}
+
+	sums := map[string]string{}
+	err = filepath.WalkDir(stagedLoc, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(stagedLoc, p)
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("%s contains %s, which is not a regular file or directory", aipLocation, filepath.ToSlash(rel))
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		sum, err := sha256Sum(f)
+		if err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = sum
+		return nil
+	})
+
+	return sums, err
+}
+
+// writeAndHash writes r to target and returns its sha256
+func writeAndHash(target string, r io.Reader, perm fs.FileMode, modTime time.Time) (string, error) {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm|0200)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), r); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Chtimes(target, modTime, modTime); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyStagedAIP checks the hashes of a staged AIP's files against manifest-sha256.txt and tagmanifest-sha256.txt,
+// and that the payload holds exactly the files in the manifest, which stands in for validating the bag
+func verifyStagedAIP(name string, stagedLoc string, sums map[string]string) error {
+	problems := []string{}
+
+	manifest, err := parseManifest(filepath.Join(stagedLoc, "manifest-sha256.txt"))
+	if err != nil {
+		return err
+	}
+
+	expected := map[string]string{}
+	for p, sum := range manifest {
+		expected[p] = sum
+	}
+
+	if _, err := os.Stat(filepath.Join(stagedLoc, "tagmanifest-sha256.txt")); err == nil {
+		tagManifest, err := parseManifest(filepath.Join(stagedLoc, "tagmanifest-sha256.txt"))
+		if err != nil {
+			return err
+		}
+		for p, sum := range tagManifest {
+			expected[p] = sum
+		}
+	}
+
+	for p, sum := range expected {
+		stagedSum, found := sums[p]
+		switch {
+		case !found:
+			problems = append(problems, fmt.Sprintf("%s is missing", p))
+		case !strings.EqualFold(stagedSum, sum):
+			problems = append(problems, fmt.Sprintf("%s has checksum %s, expected %s", p, stagedSum, sum))
+		}
+	}
+
+	for p := range sums {
+		if _, found := manifest[p]; strings.HasPrefix(p, "data/") && !found {
+			problems = append(problems, fmt.Sprintf("%s is not in manifest-sha256.txt", p))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	sort.Strings(problems)
+	for _, problem := range problems {
+		log.Printf("[ERROR] %s: %s\n", name, problem)
+	}
+	return fmt.Errorf("%d staged files failed verification, first: %s", len(problems), problems[0])
+}
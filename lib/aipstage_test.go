@@ -0,0 +1,176 @@
+package lib
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAIPName = "cc_ER_1-00000000-0000-0000-0000-000000000000"
+
+// testAIPEntry is a file, directory or symlink in a test AIP, by its path in the archive
+type testAIPEntry struct {
+	name     string
+	content  string
+	typeflag byte
+	link     string
+}
+
+// testAIPEntries returns the entries of a bag holding one payload file and a manifest listing it with manifestContent
+func testAIPEntries(manifestContent string) []testAIPEntry {
+	sum := sha256.Sum256([]byte(manifestContent))
+	return []testAIPEntry{
+		{name: testAIPName + "/", typeflag: tar.TypeDir},
+		{name: testAIPName + "/data/", typeflag: tar.TypeDir},
+		{name: testAIPName + "/data/file.txt", content: "content\n", typeflag: tar.TypeReg},
+		{name: testAIPName + "/manifest-sha256.txt", content: fmt.Sprintf("%s  data/file.txt\n", hex.EncodeToString(sum[:])), typeflag: tar.TypeReg},
+	}
+}
+
+// writeTestAIPTarGz writes the entries to a tar.gz AIP
+func writeTestAIPTarGz(t *testing.T, entries []testAIPEntry) string {
+	t.Helper()
+
+	aipLocation := filepath.Join(t.TempDir(), testAIPName+".tar.gz")
+	f, err := os.Create(aipLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gzipWriter := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Linkname: entry.link, Mode: 0664, Size: int64(len(entry.content))}
+		if entry.typeflag == tar.TypeDir {
+			header.Mode = 0775
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return aipLocation
+}
+
+// writeTestAIPDir writes the entries to an uncompressed AIP directory
+func writeTestAIPDir(t *testing.T, entries []testAIPEntry) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for _, entry := range entries {
+		p := filepath.Join(root, filepath.FromSlash(entry.name))
+		switch entry.typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, 0775); err != nil {
+				t.Fatal(err)
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(entry.link, p); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			if err := os.WriteFile(p, []byte(entry.content), 0664); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	return filepath.Join(root, testAIPName)
+}
+
+func TestStageAIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testAIPEntry
+		wantErr string
+	}{
+		{"valid bag", testAIPEntries("content\n"), ""},
+		{"file does not match the manifest", testAIPEntries("other content\n"), "failed verification"},
+		{"file not in the manifest", append(testAIPEntries("content\n"), testAIPEntry{name: testAIPName + "/data/extra.txt", content: "extra\n", typeflag: tar.TypeReg}), "failed verification"},
+		{"symlink", append(testAIPEntries("content\n"), testAIPEntry{name: testAIPName + "/data/link.txt", typeflag: tar.TypeSymlink, link: "file.txt"}), "not a regular file"},
+	}
+
+	for _, tt := range tests {
+		for _, format := range []string{"tar.gz", "directory"} {
+			t.Run(tt.name+" "+format, func(t *testing.T) {
+				var aipLocation string
+				if format == "tar.gz" {
+					aipLocation = writeTestAIPTarGz(t, tt.entries)
+				} else {
+					aipLocation = writeTestAIPDir(t, tt.entries)
+				}
+
+				stagingLoc := t.TempDir()
+				stagedLoc, numFiles, err := stageAIP(aipLocation, stagingLoc)
+				if tt.wantErr == "" {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if numFiles != 2 {
+						t.Errorf("got %d files verified, want 2", numFiles)
+					}
+					if _, err := os.Stat(filepath.Join(stagedLoc, "data", "file.txt")); err != nil {
+						t.Error(err)
+					}
+					return
+				}
+
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+
+				if _, err := os.Stat(filepath.Join(stagingLoc, testAIPName)); !os.IsNotExist(err) {
+					t.Errorf("the staged copy of a failed AIP was not removed")
+				}
+			})
+		}
+	}
+}
+
+func TestExtractTarGzRejectsEscapingEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+	}{
+		{"parent directory", testAIPName + "/../escaped.txt"},
+		{"nested parent directory", testAIPName + "/data/../../escaped.txt"},
+		{"absolute", "/tmp/escaped.txt"},
+		{"outside the AIP directory", "other/escaped.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := append(testAIPEntries("content\n"), testAIPEntry{name: tt.entry, content: "escaped\n", typeflag: tar.TypeReg})
+			aipLocation := writeTestAIPTarGz(t, entries)
+
+			stagingLoc := t.TempDir()
+			_, err := extractTarGz(aipLocation, testAIPName, filepath.Join(stagingLoc, testAIPName))
+			if err == nil || !strings.Contains(err.Error(), "outside of") {
+				t.Fatalf("got %v, want %s rejected", err, tt.entry)
+			}
+
+			if _, err := os.Stat(filepath.Join(stagingLoc, "escaped.txt")); !os.IsNotExist(err) {
+				t.Errorf("%s was written outside of the AIP", tt.entry)
+			}
+		})
+	}
+}
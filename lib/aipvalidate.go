@@ -0,0 +1,345 @@
+package lib
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	bagit "github.com/nyudlts/go-bagit"
+)
+
+// AIPValidateOptions holds the settings for `aip validate`
+type AIPValidateOptions struct {
+	AIPLoc     string
+	Full       bool
+	ProfileLoc string
+	NumWorkers int
+	AIPFileLoc string
+	AIPs       []string
+}
+
+type aipValidation struct {
+	AIP      string
+	Problems []string
+}
+
+func ValidateAIPs(opts AIPValidateOptions) error {
+	fmt.Printf("ewt aip validate, %s\n", VERSION)
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	var profile *BagItProfile
+	profileLoc := firstNonEmpty(opts.ProfileLoc, config.BagInfoProfile.BagItProfile)
+	if profileLoc != "" {
+		p, err := loadBagItProfile(profileLoc)
+		if err != nil {
+			return err
+		}
+		profile = &p
+		fmt.Printf("  * validating against bagit profile %s\n", profileLoc)
+	}
+
+	opts.AIPLoc = firstNonEmpty(opts.AIPLoc, config.AIPLoc)
+	aipLoc, err := os.Stat(opts.AIPLoc)
+	if err != nil {
+		return err
+	}
+
+	if !aipLoc.IsDir() {
+		return fmt.Errorf("%s is not a location", opts.AIPLoc)
+	}
+
+	aipLocations, err := getAIPsToValidate(opts)
+	if err != nil {
+		return err
+	}
+
+	logFile, err := os.Create(currentProject().LogLoc("aip-validation.log"))
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	log.SetOutput(logFile)
+
+	if opts.NumWorkers < 1 {
+		opts.NumWorkers = 1
+	}
+	fmt.Printf("  * validating %d aips with %d workers\n", len(aipLocations), opts.NumWorkers)
+	log.Printf("[INFO] ewt aip validate %s, validating %d aips with %d workers, full: %t\n", VERSION, len(aipLocations), opts.NumWorkers, opts.Full)
+
+	//validate every aip on a pool of workers, rather than stopping at the first invalid one
+	validations := make([]aipValidation, len(aipLocations))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < opts.NumWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				validation := validateAIP(aipLocations[i], opts.Full, profile)
+				validations[i] = validation
+				logValidation(validation)
+			}
+		}()
+	}
+
+	for i := range aipLocations {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	numInvalid := 0
+	for _, validation := range validations {
+		if len(validation.Problems) > 0 {
+			numInvalid++
+		}
+	}
+	printValidationTable(validations)
+
+	reportLoc := currentProject().LogLoc("aip-validation.tsv")
+	if err := writeValidationReport(reportLoc, validations); err != nil {
+		return err
+	}
+	fmt.Printf("  * report written to %s\n", reportLoc)
+
+	if numInvalid > 0 {
+		return fmt.Errorf("%d of %d aips are invalid", numInvalid, len(validations))
+	}
+
+	return nil
+}
+
+// getAIPsToValidate lists the aips in the aips location, narrowed to those in an aip-file or named in opts.AIPs if given
+func getAIPsToValidate(opts AIPValidateOptions) ([]string, error) {
+	directoryEntries, err := os.ReadDir(opts.AIPLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	aips := map[string]string{}
+	names := []string{}
+	for _, entry := range directoryEntries {
+		if !entry.IsDir() && getAIPName(entry.Name()) == entry.Name() {
+			continue
+		}
+		aips[getAIPName(entry.Name())] = filepath.Join(opts.AIPLoc, entry.Name())
+		names = append(names, getAIPName(entry.Name()))
+	}
+
+	subset := []string{}
+	for _, aip := range opts.AIPs {
+		subset = append(subset, getAIPName(filepath.Base(filepath.Clean(aip))))
+	}
+
+	if opts.AIPFileLoc != "" {
+		aipFileLocations, err := readAIPFile(opts.AIPFileLoc)
+		if err != nil {
+			return nil, err
+		}
+		for _, aipLocation := range aipFileLocations {
+			subset = append(subset, getAIPName(aipLocation))
+		}
+	}
+
+	if len(opts.AIPs) == 0 && opts.AIPFileLoc == "" {
+		subset = names
+	}
+
+	aipLocations, missing := []string{}, []string{}
+	for _, name := range subset {
+		aipLocation, found := aips[name]
+		if !found {
+			missing = append(missing, name)
+			continue
+		}
+		if !slices.Contains(aipLocations, aipLocation) {
+			aipLocations = append(aipLocations, aipLocation)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("aips not found in %s: %s", opts.AIPLoc, strings.Join(missing, ", "))
+	}
+
+	if len(aipLocations) == 0 {
+		return nil, fmt.Errorf("no aips to validate in %s", opts.AIPLoc)
+	}
+
+	return aipLocations, nil
+}
+
+func logValidation(validation aipValidation) {
+	if len(validation.Problems) == 0 {
+		log.Printf("[INFO] %s: VALID\n", validation.AIP)
+		return
+	}
+
+	log.Printf("[ERROR] %s: INVALID, %d problems\n", validation.AIP, len(validation.Problems))
+	for _, problem := range validation.Problems {
+		log.Printf("[ERROR] %s: %s\n", validation.AIP, problem)
+	}
+}
+
+func printValidationTable(validations []aipValidation) {
+	fmt.Println()
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "AIP\tSTATUS\tPROBLEMS\tFIRST PROBLEM")
+	for _, validation := range validations {
+		status, firstProblem := "VALID", ""
+		if len(validation.Problems) > 0 {
+			status, firstProblem = "INVALID", validation.Problems[0]
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\n", validation.AIP, status, len(validation.Problems), firstProblem)
+	}
+	table.Flush()
+	fmt.Println()
+}
+
+// validateAIP checks an AIP's checksums, its layout after prep, and, if given, the bagit profile, returning every problem found
+func validateAIP(aipLocation string, full bool, profile *BagItProfile) aipValidation {
+	validation := aipValidation{AIP: filepath.Base(aipLocation), Problems: []string{}}
+	addProblems := func(check string, problems ...string) {
+		for _, problem := range problems {
+			validation.Problems = append(validation.Problems, fmt.Sprintf("%s: %s", check, problem))
+		}
+	}
+
+	info, err := os.Stat(aipLocation)
+	if err != nil {
+		addProblems("bagit", err.Error())
+		return validation
+	}
+
+	//serialized aips can only be checked against the profile's serialization rules
+	if !info.IsDir() {
+		if profile != nil {
+			addProblems("profile", profile.checkSerialization(aipLocation)...)
+		}
+		addProblems("bagit", "serialized aips are not validated, extract them with aip prep")
+		return validation
+	}
+
+	//validate the bag's checksums, or its payload oxum when not doing a full validation
+	log.Printf("[INFO] %s: validating bag, full: %t\n", validation.AIP, full)
+	bag, err := bagit.GetExistingBag(aipLocation)
+	if err != nil {
+		addProblems("bagit", err.Error())
+	} else if err := bag.ValidateBag(!full, false); err != nil {
+		addProblems("bagit", splitBagItErrors(err)...)
+	}
+
+	//check that the work order and transfer-info.txt are where prep left them
+	problems, err := checkAIPLayout(aipLocation)
+	if err != nil {
+		addProblems("layout", err.Error())
+	}
+	addProblems("layout", problems...)
+
+	if profile != nil {
+		problems, err := profile.checkBag(aipLocation)
+		if err != nil {
+			addProblems("profile", err.Error())
+		}
+		addProblems("profile", problems...)
+	}
+
+	return validation
+}
+
+// splitBagItErrors splits the errors go-bagit joins into a single message during validation into one per file
+func splitBagItErrors(err error) []string {
+	msg := strings.TrimPrefix(err.Error(), "- ERROR - ")
+	if _, failures, found := strings.Cut(msg, "Bag validation failed: "); found {
+		return strings.Split(failures, "; ")
+	}
+	return []string{msg}
+}
+
+// checkAIPLayout checks that a prepped AIP has a single work order at its root, listed in tagmanifest-sha256.txt,
+// and a single transfer-info.txt in the payload's metadata directory
+func checkAIPLayout(aipLocation string) ([]string, error) {
+	problems := []string{}
+
+	entries, err := os.ReadDir(aipLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	workOrders := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && woMatcher.MatchString(entry.Name()) {
+			workOrders = append(workOrders, entry.Name())
+		}
+	}
+
+	switch len(workOrders) {
+	case 0:
+		problems = append(problems, "no work order in the bag's root")
+	case 1:
+		tagManifest, err := parseManifest(filepath.Join(aipLocation, "tagmanifest-sha256.txt"))
+		if err != nil {
+			return nil, err
+		}
+		if _, found := tagManifest[workOrders[0]]; !found {
+			problems = append(problems, fmt.Sprintf("work order %s is not in tagmanifest-sha256.txt", workOrders[0]))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%d work orders in the bag's root", len(workOrders)))
+	}
+
+	manifest, err := parseManifest(filepath.Join(aipLocation, "manifest-sha256.txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	transferInfos := []string{}
+	for p := range manifest {
+		if tiMatcher.MatchString(path.Base(p)) {
+			transferInfos = append(transferInfos, p)
+		}
+	}
+
+	switch {
+	case len(transferInfos) == 0:
+		problems = append(problems, "no transfer-info.txt in the payload")
+	case len(transferInfos) > 1:
+		problems = append(problems, fmt.Sprintf("%d transfer-info.txt files in the payload", len(transferInfos)))
+	case !strings.HasPrefix(transferInfos[0], "data/objects/metadata/"):
+		problems = append(problems, fmt.Sprintf("transfer-info.txt is at %s, outside of data/objects/metadata", transferInfos[0]))
+	}
+
+	return problems, nil
+}
+
+func writeValidationReport(reportLoc string, validations []aipValidation) error {
+	reportFile, err := os.Create(reportLoc)
+	if err != nil {
+		return err
+	}
+	defer reportFile.Close()
+
+	writer := csv.NewWriter(reportFile)
+	writer.Comma = '\t'
+	writer.Write([]string{"aip", "status", "num_problems", "problems"})
+	for _, validation := range validations {
+		status := "VALID"
+		if len(validation.Problems) > 0 {
+			status = "INVALID"
+		}
+		writer.Write([]string{validation.AIP, status, strconv.Itoa(len(validation.Problems)), strings.Join(validation.Problems, "; ")})
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
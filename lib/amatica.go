@@ -12,7 +12,6 @@ import (
 	"strings"
 
 	"github.com/nyudlts/go-aspace"
-	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -21,23 +20,13 @@ var (
 	infectedFilesPtn = regexp.MustCompile("\nInfected files: 0\n")
 )
 
-func PrintXferPackageSize(directories bool) error {
-	fmt.Println("ewt amatica size, version", VERSION)
+func PrintXferPackageSize(opts SizeOptions) error {
+	printSizeHeader("amatica", opts)
 	if err := loadConfig(); err != nil {
 		return err
 	}
 
-	if err := getPackageSize(config.XferLoc); err != nil {
-		return err
-	}
-
-	if directories {
-		if err := printDirectoryStats(config.XferLoc); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return printPackageSize(config.XferLoc, opts)
 }
 
 func PrepAmatica(nWorkers int) error {
@@ -61,7 +50,7 @@ func PrepAmatica(nWorkers int) error {
 		return err
 	}
 
-	mdDir := filepath.Join(config.SIPLoc, "metadata")
+	mdDir := currentProject().Paths().SIPMetadata
 	var err error
 	params.WorkOrder, err = parseWorkOrder(mdDir, filepath.Base(workOrderLocation))
 	if err != nil {
@@ -69,16 +58,11 @@ func PrepAmatica(nWorkers int) error {
 	}
 
 	//create the transfer-info struct
-	transferInfoLoc := filepath.Join(mdDir, "transfer-info.txt")
-	transferInfoBytes, err := os.ReadFile(transferInfoLoc)
+	transferInfo, err = currentProject().TransferInfo()
 	if err != nil {
 		return err
 	}
 
-	if err := yaml.Unmarshal(transferInfoBytes, &transferInfo); err != nil {
-		return err
-	}
-
 	params.TransferInfo = transferInfo
 
 	log.Println("[INFO] creating Transfer packages")
@@ -89,8 +73,7 @@ func PrepAmatica(nWorkers int) error {
 
 	//create an output log
 	log.Println("[INFO] creating output report")
-	outputTSVfilename := fmt.Sprintf("%s-xip-prep.tsv", params.ResourceCode)
-	outputFile, err := os.Create(filepath.Join(config.LogLoc, outputTSVfilename))
+	outputFile, err := currentProject().CreateLog("xip-prep.tsv")
 	if err != nil {
 		return err
 	}
@@ -255,7 +238,7 @@ func createERPackage(row aspace.WorkOrderRow, workerId int) error {
 	log.Printf("[INFO] WORKER %d moving payload %s to xfer dir", workerId, erID)
 	// move the payload directory to to er directory
 	payloadSource := filepath.Join(config.SIPLoc, erID)
-	payloadTarget := filepath.Join("xfer", ERDirName, erID)
+	payloadTarget := filepath.Join(config.XferLoc, ERDirName, erID)
 	fmt.Printf("    source: %s\n    target: %s\n", payloadSource, payloadTarget)
 
 	if err := os.Rename(payloadSource, payloadTarget); err != nil {
@@ -0,0 +1,435 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	amatica "github.com/nyudlts/go-archivematica"
+)
+
+const timeFormat = "2006-01-02 15:04:05"
+
+// AmaticaTransferOptions holds the settings for `amatica transfer`
+type AmaticaTransferOptions struct {
+	ConfigLoc string
+	PollTime  int
+}
+
+// AmaticaClearOptions holds the settings for `amatica clear`
+type AmaticaClearOptions struct {
+	ConfigLoc string
+	Transfers bool
+	Ingests   bool
+}
+
+// amaticaTransfer transfers a project's xfer packages through archivematica, recording the AIPs it creates in the
+// project's aip-file.txt
+type amaticaTransfer struct {
+	project   *Project
+	client    *amatica.AMClient
+	location  amatica.Location
+	poll      time.Duration
+	aipWriter *bufio.Writer
+}
+
+func TransferToAmatica(opts AmaticaTransferOptions) error {
+	fmt.Printf("ewt amatica transfer, %s\n", VERSION)
+
+	//load the project config
+	project, err := FindProject()
+	if err != nil {
+		return err
+	}
+
+	//check the archivematica config and the transfer directory
+	fmt.Println("checking program flags")
+	amaticaConfigLoc, err := getAmaticaConfig(firstNonEmpty(opts.ConfigLoc, project.Config.AmaticaConfigLoc))
+	if err != nil {
+		return err
+	}
+
+	xferLoc := project.Paths().Xfer
+	fi, err := os.Stat(xferLoc)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", xferLoc)
+	}
+
+	//create a log file
+	fmt.Println("creating log File")
+	logFile, err := project.CreateLog("amatica-transfer.log")
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	log.SetOutput(logFile)
+
+	//create the aip-file
+	fmt.Printf("creating %s-aip-file.txt\n", project.Config.CollectionCode)
+	log.Printf("[INFO] creating %s-aip-file.txt", project.Config.CollectionCode)
+	aipFile, err := project.CreateLog("aip-file.txt")
+	if err != nil {
+		return err
+	}
+	defer aipFile.Close()
+
+	transfer := amaticaTransfer{project: project, aipWriter: bufio.NewWriter(aipFile)}
+
+	//set the poll time
+	fmt.Printf("setting polling time to %d seconds\n", opts.PollTime)
+	log.Printf("[INFO] setting polling time to %d seconds", opts.PollTime)
+	transfer.poll = time.Duration(opts.PollTime) * time.Second
+
+	//create a client
+	fmt.Println("creating go-archivematica client")
+	log.Println("[INFO] creating go-archivematica client")
+	transfer.client, err = amatica.NewAMClient(amaticaConfigLoc, 20)
+	if err != nil {
+		return err
+	}
+
+	//process the directory
+	fmt.Printf("reading source directory: %s\n", xferLoc)
+	log.Printf("[INFO] reading source directory: %s", xferLoc)
+	xferDirs, err := os.ReadDir(xferLoc)
+	if err != nil {
+		return err
+	}
+
+	if len(xferDirs) < 1 {
+		return fmt.Errorf("transfer directory is empty")
+	}
+
+	fmt.Printf("transferring packages from %s\n", xferLoc)
+	log.Printf("[INFO] transferring packages from %s", xferLoc)
+	for _, xferDir := range xferDirs {
+		//the path to the package in archivematica's transfer source
+		xipPath := filepath.Join(project.Config.CollectionCode, "xfer", xferDir.Name())
+		if err := transfer.transferPackage(xipPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getAmaticaConfig checks the go-archivematica config to use
+func getAmaticaConfig(configLoc string) (string, error) {
+	if configLoc == "" {
+		return "", fmt.Errorf("no go-archivematica config, use --config or set `archivematica-config` in config.yml")
+	}
+
+	fi, err := os.Stat(configLoc)
+	if err != nil {
+		return "", err
+	}
+
+	if fi.IsDir() {
+		return "", fmt.Errorf("%s is a directory, config file required", configLoc)
+	}
+
+	return configLoc, nil
+}
+
+func (t *amaticaTransfer) transferPackage(xipPath string) error {
+
+	//initialize the transfer
+	xipName := filepath.Base(xipPath)
+	fmt.Printf("\ninitializing transfer for %s\n", xipName)
+	amXIPPath, err := t.initTransfer(xipPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("transfer %s initialized\n", amXIPPath)
+	log.Printf("[INFO] transfer %s initialized\n", amXIPPath)
+
+	//request the transfer through archivematica
+	fmt.Printf("requesting transfer processing for %s\n", xipName)
+	transferUUID, err := t.requestTransfer(amXIPPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("transfer processing requested for %s-%s\n", amXIPPath, transferUUID)
+	log.Printf("[INFO] transfer processing requested for %s-%s", amXIPPath, transferUUID)
+
+	//approve the transfer
+	fmt.Printf("approving %s: %s for transfer processing\n", amXIPPath, transferUUID)
+	transferStatus, err := t.approveTransfer(transferUUID)
+	if err != nil {
+		return err
+	}
+
+	xferLabel := fmt.Sprintf("%s-%s", filepath.Base(amXIPPath), transferUUID)
+	fmt.Printf("transfer processing approved for %s\n", xferLabel)
+	log.Printf("[INFO] transfer processing archivematica approved for %s", xferLabel)
+
+	//transfer processing
+	fmt.Printf("transfer processing started for %s\n", xferLabel)
+	transferStatus, err = t.transferProcessing(transferStatus.UUID.String())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("transfer processing completed for %s\n", xferLabel)
+	log.Printf("[INFO] transfer processing completed for %s", xferLabel)
+
+	//ingest processing
+	ingestLabel := fmt.Sprintf("%s-%s", filepath.Base(amXIPPath), transferStatus.SIPUUID)
+	fmt.Printf("ingest processing started for %s\n", ingestLabel)
+	//pause for api to update
+	time.Sleep(5 * time.Second)
+	ingestStatus, err := t.ingestProcessing(transferStatus.SIPUUID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("ingest processing completed for %s\n", ingestLabel)
+	log.Printf("[INFO] ingest processing completed for %s", ingestLabel)
+
+	//write path to aip-file
+	aipPath, err := amatica.ConvertUUIDToAMDirectory(ingestStatus.UUID.String())
+	if err != nil {
+		return err
+	}
+
+	aipPath = filepath.Join(aipPath, fmt.Sprintf("%s-%s", filepath.Base(xipPath), ingestStatus.UUID.String()))
+
+	aipPath = fmt.Sprintf("%s%s", "/mnt/amatica/AIPsStore/", aipPath)
+	fmt.Printf("writing %s to aip-file\n", aipPath)
+	t.aipWriter.WriteString(fmt.Sprintf("%s\n", aipPath))
+	t.aipWriter.Flush()
+	log.Printf("[INFO] %s written to aip-file", aipPath)
+	fmt.Printf("%s written to aip-file\n", aipPath)
+
+	//done
+	return nil
+}
+
+func (t *amaticaTransfer) initTransfer(xipPath string) (string, error) {
+	var err error
+	t.location, err = t.client.GetLocationByName(t.project.Config.AMTransferSource)
+	if err != nil {
+		return "", err
+	}
+
+	amXIPPath := filepath.Join(t.location.Path, xipPath)
+
+	return amXIPPath, nil
+}
+
+func (t *amaticaTransfer) requestTransfer(xipPath string) (string, error) {
+	startTransferResponse, err := t.client.StartTransfer(t.location.UUID, xipPath)
+	if err != nil {
+		return "", err
+	}
+
+	//catch the soft error
+	if regexp.MustCompile("^Error").MatchString(startTransferResponse.Message) {
+		return "", fmt.Errorf("%s", startTransferResponse.Message)
+	}
+
+	fmt.Printf("transfer request message: %s\n", startTransferResponse.Message)
+	log.Printf("[INFO] transfer request message: %s", startTransferResponse.Message)
+
+	//get the uuid for the transfer
+	uuid, err := startTransferResponse.GetUUID()
+	if err != nil {
+		return "", err
+	}
+	return uuid, nil
+}
+
+func (t *amaticaTransfer) approveTransfer(xferUUID string) (amatica.TransferStatus, error) {
+	foundUnapproved := false
+	for !foundUnapproved {
+		var err error
+		foundUnapproved, err = t.findUnapprovedTransfer(xferUUID)
+		if err != nil {
+			return amatica.TransferStatus{}, err
+		}
+
+		if !foundUnapproved {
+			fmt.Printf("  * %s waiting for approval process to complete\n", time.Now().Format(timeFormat))
+			time.Sleep(t.poll)
+		}
+	}
+
+	//approve the transfer
+	transfer, err := t.client.GetTransferStatus(xferUUID)
+	if err != nil {
+		return amatica.TransferStatus{}, err
+	}
+
+	if err := t.client.ApproveTransfer(transfer.Directory, "standard"); err != nil {
+		return amatica.TransferStatus{}, err
+	}
+
+	approvedTransfer, err := t.client.GetTransferStatus(xferUUID)
+	if err != nil {
+		return amatica.TransferStatus{}, err
+	}
+
+	return approvedTransfer, nil
+}
+
+func (t *amaticaTransfer) findUnapprovedTransfer(uuid string) (bool, error) {
+	unapprovedTransfers, err := t.client.GetUnapprovedTransfers()
+	if err != nil {
+		return false, err
+	}
+
+	unapprovedTransfersMap, err := t.client.GetUnapprovedTransfersMap(unapprovedTransfers)
+	if err != nil {
+		return false, err
+	}
+
+	//find the unapproved transfer
+	_, found := unapprovedTransfersMap[uuid]
+	return found, nil
+}
+
+func (t *amaticaTransfer) transferProcessing(xferUUID string) (amatica.TransferStatus, error) {
+
+	//change this logic over to a channel
+	foundCompleted := false
+	for !foundCompleted {
+		ts, err := t.client.GetTransferStatus(xferUUID)
+		if err != nil {
+			return amatica.TransferStatus{}, err
+		}
+
+		if ts.Status == "FAILED" {
+			return amatica.TransferStatus{}, fmt.Errorf("%s", ts.Microservice)
+		}
+
+		if ts.Status == "" {
+			return amatica.TransferStatus{}, fmt.Errorf("no status being returned")
+		}
+
+		if ts.Status == "COMPLETE" {
+			foundCompleted = true
+		}
+
+		if !foundCompleted {
+			fmt.Printf("  * %s Transfer Status: %s,  Microservice: %s\n", time.Now().Format(timeFormat), ts.Status, ts.Microservice)
+			time.Sleep(t.poll)
+		}
+	}
+
+	completedTransfer, err := t.client.GetTransferStatus(xferUUID)
+	if err != nil {
+		return amatica.TransferStatus{}, err
+	}
+
+	sipUUID := completedTransfer.SIPUUID
+	if sipUUID == "" {
+		return amatica.TransferStatus{}, fmt.Errorf("no sip-uuid returned")
+	}
+
+	return completedTransfer, nil
+}
+
+func (t *amaticaTransfer) ingestProcessing(ingestUUID string) (amatica.IngestStatus, error) {
+	foundIngestCompleted := false
+	var ingestStatus amatica.IngestStatus
+	var err error
+	for !foundIngestCompleted {
+		ingestStatus, err = t.client.GetIngestStatus(ingestUUID)
+		if err != nil {
+			return amatica.IngestStatus{}, err
+		}
+
+		if ingestStatus.Status == "FAILED" {
+			return amatica.IngestStatus{}, fmt.Errorf("%s", ingestStatus.Microservice)
+		}
+
+		if ingestStatus.Status == "" {
+			return amatica.IngestStatus{}, fmt.Errorf("no status being returned")
+		}
+
+		if ingestStatus.Status == "COMPLETE" {
+			foundIngestCompleted = true
+		}
+
+		if !foundIngestCompleted {
+			fmt.Printf("  * %s Ingest Status: %s,  Microservice: %s\n", time.Now().Format(timeFormat), ingestStatus.Status, ingestStatus.Microservice)
+			time.Sleep(t.poll)
+		}
+	}
+
+	return ingestStatus, nil
+
+}
+
+// ClearAmatica removes completed transfers and ingests from archivematica's dashboard
+func ClearAmatica(opts AmaticaClearOptions) error {
+	//clear does not need a project, the site and user config still apply outside of one
+	projectConfigLoc, err := FindConfig()
+	if err != nil {
+		projectConfigLoc = ""
+	}
+
+	layered, err := loadLayeredConfig(projectConfigLoc)
+	if err != nil {
+		return err
+	}
+
+	amaticaConfigLoc, err := getAmaticaConfig(firstNonEmpty(opts.ConfigLoc, layered.Config.AmaticaConfigLoc))
+	if err != nil {
+		return err
+	}
+
+	client, err := amatica.NewAMClient(amaticaConfigLoc, 20)
+	if err != nil {
+		return err
+	}
+
+	if opts.Transfers {
+		fmt.Println("Clearing completed transfers")
+		completedTransfers, err := client.GetCompletedTransfers()
+		if err != nil {
+			return err
+		}
+
+		completedTransfersMap, err := client.GetCompletedTransfersMap(completedTransfers)
+		if err != nil {
+			return err
+		}
+
+		for k, v := range completedTransfersMap {
+			fmt.Printf("clearing %s: %s\n", k, v.Name)
+			if err := client.DeleteTransfer(v.UUID); err != nil {
+				return err
+			}
+			fmt.Printf("%s: %s cleared\n", k, v.Name)
+		}
+	}
+
+	if opts.Ingests {
+		completedIngests, err := client.GetCompletedIngests()
+		if err != nil {
+			return err
+		}
+
+		completedIngestsMap, err := client.GetCompletedIngestsMap(completedIngests)
+		if err != nil {
+			return err
+		}
+
+		for k, v := range completedIngestsMap {
+			fmt.Printf("clearing %s: %s\n", k, v.Name)
+			if err := client.DeleteIngest(v.UUID); err != nil {
+				return err
+			}
+			fmt.Printf("%s: %s cleared\n", k, v.Name)
+		}
+	}
+
+	return nil
+}
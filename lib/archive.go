@@ -0,0 +1,729 @@
+package lib
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultArchiveLoc is used when neither --archive-location nor archive-location in config.yml is set, alongside the
+// project directories
+const defaultArchiveLoc = "completed"
+
+// unarchivedDirs are removed with the project rather than archived, the aips are delivered to R* and the xfer
+// packages are held by archivematica
+var unarchivedDirs = []string{"aips", "xfer"}
+
+// archiveManifestName is the manifest written at the root of each archive
+const archiveManifestName = "archive-manifest.yml"
+
+// ArchiveOptions holds the settings for `project archive`
+type ArchiveOptions struct {
+	ProjectLoc string
+	ArchiveLoc string
+	Force      bool
+}
+
+// archiveManifest records what was archived and what was removed with the project
+type archiveManifest struct {
+	Project        string          `yaml:"project"`
+	CollectionCode string          `yaml:"collection-code"`
+	ArchivedAt     string          `yaml:"archived-at"`
+	ErwtVersion    string          `yaml:"erwt-version"`
+	Forced         bool            `yaml:"forced"`
+	Gaps           []string        `yaml:"gaps,omitempty"`
+	Skipped        []string        `yaml:"skipped,omitempty"`
+	Kept           []archivedEntry `yaml:"kept"`
+	Removed        []archivedEntry `yaml:"removed"`
+}
+
+type archivedEntry struct {
+	Path     string `yaml:"path"`
+	NumFiles int    `yaml:"num-files"`
+	Size     int64  `yaml:"size"`
+}
+
+// ArchiveProject writes a project to `<archive-location>/<project>.tgz` with a sha256 sidecar, re-reads the archive
+// to verify it and only then removes the project directory. Projects that do not reconcile as complete are only
+// archived when forced
+func ArchiveProject(opts ArchiveOptions) error {
+	fmt.Println("ewt project archive, version", VERSION)
+
+	//default to the project set with --project or ERWT_PROJECT, or found from the working directory
+	if opts.ProjectLoc == "" {
+		configLoc, err := FindConfig()
+		if err != nil {
+			return err
+		}
+		opts.ProjectLoc = filepath.Dir(configLoc)
+	}
+
+	projectLoc, err := filepath.Abs(opts.ProjectLoc)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(projectLoc); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", projectLoc)
+	}
+
+	archiveLoc, err := getArchiveLoc(opts.ArchiveLoc, filepath.Join(projectLoc, "config.yml"))
+	if err != nil {
+		return err
+	}
+
+	archiveLoc, err = filepath.Abs(archiveLoc)
+	if err != nil {
+		return err
+	}
+
+	//the archive can not be written into the directory that is removed once it is verified
+	if rel, err := filepath.Rel(projectLoc, archiveLoc); err == nil && (rel == "." || filepath.IsLocal(rel)) {
+		return fmt.Errorf("archive location %s is inside the project %s", archiveLoc, projectLoc)
+	}
+
+	if err := os.MkdirAll(archiveLoc, 0775); err != nil {
+		return err
+	}
+
+	archiveFile := filepath.Join(archiveLoc, filepath.Base(projectLoc)+".tgz")
+	if _, err := os.Stat(archiveFile); err == nil {
+		return fmt.Errorf("%s already exists", archiveFile)
+	}
+
+	//sockets, fifos and devices can not be archived, removing the project would lose them
+	skipped, err := getUnarchivableFiles(projectLoc)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range skipped {
+		fmt.Printf("  * %s is not a regular file, directory or symlink and can not be archived\n", name)
+	}
+
+	if len(skipped) > 0 && !opts.Force {
+		return fmt.Errorf("%s holds files that can not be archived, remove them or use --force to archive the project without them", projectLoc)
+	}
+
+	fmt.Println("  * reconciling project")
+	gaps, err := getProjectGaps(projectLoc)
+	if err != nil {
+		if !opts.Force {
+			return fmt.Errorf("could not reconcile %s, use --force to archive it anyway: %w", projectLoc, err)
+		}
+		fmt.Printf("  * could not reconcile project: %s\n", err.Error())
+		gaps = append(gaps, fmt.Sprintf("could not reconcile project: %s", err.Error()))
+	}
+
+	for _, gap := range gaps {
+		fmt.Printf("  * %s\n", gap)
+	}
+
+	if len(gaps) > 0 && !opts.Force {
+		return fmt.Errorf("%s is not complete, run `erwt project reconcile` in the project for details or use --force to archive it anyway", projectLoc)
+	}
+
+	if len(gaps) > 0 {
+		fmt.Println("  * --force set, archiving incomplete project")
+	}
+
+	manifest, err := getArchiveManifest(projectLoc, opts.Force, gaps, skipped)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("  * archiving %s to %s\n", projectLoc, archiveFile)
+	sums, archiveSum, err := writeProjectArchive(projectLoc, archiveFile, manifest)
+	if err != nil {
+		os.Remove(archiveFile)
+		return err
+	}
+
+	checksumFile := archiveFile + ".sha256"
+	if err := os.WriteFile(checksumFile, []byte(fmt.Sprintf("%s  %s\n", archiveSum, filepath.Base(archiveFile))), 0664); err != nil {
+		os.Remove(archiveFile)
+		return err
+	}
+	fmt.Printf("  * checksum written to %s\n", checksumFile)
+
+	fmt.Println("  * verifying archive")
+	numFiles, err := verifyProjectArchive(archiveFile, sums)
+	if err != nil {
+		//a failed archive would otherwise block the next attempt as already existing
+		for _, f := range []string{archiveFile, checksumFile} {
+			if removeErr := os.Remove(f); removeErr != nil {
+				fmt.Printf("  * could not remove %s: %s\n", f, removeErr.Error())
+			}
+		}
+		return fmt.Errorf("%s failed verification and was removed, %s was not removed: %w", archiveFile, projectLoc, err)
+	}
+	fmt.Printf("  * verified %d files in %s\n", numFiles, archiveFile)
+
+	fmt.Printf("  * removing project directory %s\n", projectLoc)
+	if err := os.RemoveAll(projectLoc); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RestoreProject verifies an archived project against its checksum and unpacks it to `<destination>/<project>`
+func RestoreProject(archive string, destination string, archiveLoc string) error {
+	fmt.Println("ewt project restore, version", VERSION)
+
+	archiveFile, err := findArchive(archive, archiveLoc)
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(destination, strings.TrimSuffix(filepath.Base(archiveFile), ".tgz"))
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("%s already exists", target)
+	}
+
+	fmt.Printf("  * verifying %s\n", archiveFile)
+	if _, err := verifyProjectArchive(archiveFile, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("  * restoring %s to %s\n", archiveFile, target)
+	numFiles, err := extractProjectArchive(archiveFile, target)
+	if err != nil {
+		os.RemoveAll(target)
+		return err
+	}
+	fmt.Printf("  * restored %d files to %s\n", numFiles, target)
+
+	//the project's config.yml holds absolute paths, which will be stale if it is restored somewhere else
+	restoredConfig := Config{}
+	if b, err := os.ReadFile(filepath.Join(target, "config.yml")); err == nil && yaml.Unmarshal(b, &restoredConfig) == nil {
+		if absTarget, err := filepath.Abs(target); err == nil && restoredConfig.ProjectLoc != "" && restoredConfig.ProjectLoc != absTarget {
+			fmt.Printf("  * project-location in config.yml is %s, update it before working in the restored project\n", restoredConfig.ProjectLoc)
+		}
+	}
+
+	return nil
+}
+
+// ListArchivedProjects prints the projects in the archive location with the date they were archived and their size
+func ListArchivedProjects(archiveLoc string) error {
+	fmt.Println("ewt project list-archived, version", VERSION)
+
+	configLoc, _ := FindConfig()
+	archiveLoc, err := getArchiveLoc(archiveLoc, configLoc)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(archiveLoc)
+	if os.IsNotExist(err) {
+		fmt.Printf("  * no archived projects in %s\n", archiveLoc)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "PROJECT\tARCHIVED\tSIZE\tSHA256")
+	numArchives := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tgz") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		checksum, err := readArchiveChecksum(filepath.Join(archiveLoc, entry.Name()))
+		if err != nil {
+			checksum = "missing"
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", strings.TrimSuffix(entry.Name(), ".tgz"), info.ModTime().Format("2006-01-02 15:04"), humanReadableSize(info.Size()), checksum)
+		numArchives++
+	}
+
+	if numArchives == 0 {
+		fmt.Printf("  * no archived projects in %s\n", archiveLoc)
+		return nil
+	}
+
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("  * %d archived projects in %s\n", numArchives, archiveLoc)
+
+	return nil
+}
+
+// getArchiveLoc returns the archive location from the flag, then archive-location in the project's config.yml, which
+// is relative to the project, then the default alongside the project. Without a project the default is relative to
+// the working directory
+func getArchiveLoc(archiveLoc string, configLoc string) (string, error) {
+	if archiveLoc != "" {
+		return archiveLoc, nil
+	}
+
+	if configLoc == "" {
+		return defaultArchiveLoc, nil
+	}
+
+	projectLoc := filepath.Dir(configLoc)
+	b, err := os.ReadFile(configLoc)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if err == nil {
+		projectConfig := Config{}
+		if err := yaml.Unmarshal(b, &projectConfig); err != nil {
+			return "", fmt.Errorf("could not parse %s: %w", configLoc, err)
+		}
+		if projectConfig.ArchiveLoc != "" && filepath.IsAbs(projectConfig.ArchiveLoc) {
+			return projectConfig.ArchiveLoc, nil
+		}
+		if projectConfig.ArchiveLoc != "" {
+			return filepath.Join(projectLoc, projectConfig.ArchiveLoc), nil
+		}
+	}
+
+	return filepath.Join(filepath.Dir(projectLoc), defaultArchiveLoc), nil
+}
+
+// getProjectGaps reconciles a project, returning each component id that has not been delivered to R* with its gap
+func getProjectGaps(projectLoc string) ([]string, error) {
+	if err := loadProjectConfig(projectLoc); err != nil {
+		return nil, err
+	}
+
+	records, order, err := reconcileRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	gaps := []string{}
+	for _, componentID := range order {
+		if gap := records[componentID].gap(); gap != "" {
+			gaps = append(gaps, fmt.Sprintf("%s: %s", componentID, gap))
+		}
+	}
+
+	return gaps, nil
+}
+
+// getUnarchivableFiles lists the files in the archived part of a project that are not regular files, directories or
+// symlinks
+func getUnarchivableFiles(projectLoc string) ([]string, error) {
+	skipped := []string{}
+	if err := filepath.WalkDir(projectLoc, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(projectLoc, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if d.IsDir() && isUnarchivedDir(name) {
+			return filepath.SkipDir
+		}
+
+		if !d.IsDir() && !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			skipped = append(skipped, name)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return skipped, nil
+}
+
+// getArchiveManifest lists the file counts and sizes of the top level entries of a project that are kept in the
+// archive and those that are removed, and the files skipped as they could not be archived
+func getArchiveManifest(projectLoc string, forced bool, gaps []string, skipped []string) ([]byte, error) {
+	manifest := archiveManifest{
+		Project:        filepath.Base(projectLoc),
+		CollectionCode: config.CollectionCode,
+		ArchivedAt:     time.Now().Format(time.RFC3339),
+		ErwtVersion:    VERSION,
+		Forced:         forced,
+		Gaps:           gaps,
+		Skipped:        skipped,
+		Kept:           []archivedEntry{},
+		Removed:        []archivedEntry{},
+	}
+
+	entries, err := os.ReadDir(projectLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == archiveManifestName {
+			continue
+		}
+
+		numFiles, size, err := getDirectorySize(filepath.Join(projectLoc, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		archived := archivedEntry{Path: entry.Name(), NumFiles: numFiles, Size: size}
+		if entry.IsDir() && isUnarchivedDir(entry.Name()) {
+			manifest.Removed = append(manifest.Removed, archived)
+		} else {
+			manifest.Kept = append(manifest.Kept, archived)
+		}
+	}
+
+	return yaml.Marshal(manifest)
+}
+
+// findArchive accepts the path to an archive or the name of a project in the archive location
+func findArchive(archive string, archiveLoc string) (string, error) {
+	if _, err := os.Stat(archive); err == nil {
+		return archive, nil
+	}
+
+	configLoc, _ := FindConfig()
+	archiveLoc, err := getArchiveLoc(archiveLoc, configLoc)
+	if err != nil {
+		return "", err
+	}
+
+	archiveFile := filepath.Join(archiveLoc, archive)
+	if !strings.HasSuffix(archiveFile, ".tgz") {
+		archiveFile = archiveFile + ".tgz"
+	}
+
+	if _, err := os.Stat(archiveFile); err != nil {
+		return "", fmt.Errorf("no archive found for %s: %w", archive, err)
+	}
+	return archiveFile, nil
+}
+
+// writeProjectArchive tars and gzips a project with its manifest, other than the unarchived directories, returning the
+// sha256 of each file and symlink archived and of the archive itself. Symlinks are archived as links, not followed, and
+// any other files that are not regular files are left out, these are listed in the manifest by getUnarchivableFiles
+func writeProjectArchive(projectLoc string, archiveFile string, manifest []byte) (map[string]string, string, error) {
+	f, err := os.OpenFile(archiveFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0664)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	archiveHash := sha256.New()
+	gzipWriter := gzip.NewWriter(io.MultiWriter(f, archiveHash))
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	if err := tarWriter.WriteHeader(&tar.Header{
+		Name:     archiveManifestName,
+		Mode:     0664,
+		Size:     int64(len(manifest)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return nil, "", err
+	}
+
+	if _, err := tarWriter.Write(manifest); err != nil {
+		return nil, "", err
+	}
+
+	manifestSum := sha256.Sum256(manifest)
+	sums := map[string]string{archiveManifestName: hex.EncodeToString(manifestSum[:])}
+	if err := filepath.WalkDir(projectLoc, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(projectLoc, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if d.IsDir() && isUnarchivedDir(name) {
+			return filepath.SkipDir
+		}
+
+		//the manifest of a restored project is replaced by the new one
+		if name == archiveManifestName {
+			return nil
+		}
+
+		isLink := d.Type()&fs.ModeSymlink != 0
+		if !d.IsDir() && !d.Type().IsRegular() && !isLink {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if isLink {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if d.IsDir() {
+			header.Name = name + "/"
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if isLink {
+			sums[name] = symlinkSum(link)
+			return nil
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		fileHash := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(tarWriter, fileHash), file); err != nil {
+			return err
+		}
+		sums[name] = hex.EncodeToString(fileHash.Sum(nil))
+
+		return nil
+	}); err != nil {
+		return nil, "", err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return nil, "", err
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return nil, "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return sums, hex.EncodeToString(archiveHash.Sum(nil)), nil
+}
+
+// symlinkSum is the sha256 of a symlink's target, so that verification catches a link that was archived pointing
+// somewhere else
+func symlinkSum(link string) string {
+	sum := sha256.Sum256([]byte(link))
+	return hex.EncodeToString(sum[:])
+}
+
+func isUnarchivedDir(name string) bool {
+	for _, dir := range unarchivedDirs {
+		if name == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyProjectArchive re-reads an archive, checking it against its sha256 sidecar and, when sums are given, that it
+// holds exactly the files that were archived
+func verifyProjectArchive(archiveFile string, sums map[string]string) (int, error) {
+	expectedSum, err := readArchiveChecksum(archiveFile)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(archiveFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	archiveHash := sha256.New()
+	reader := io.TeeReader(f, archiveHash)
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return 0, err
+	}
+	defer gzipReader.Close()
+
+	problems := []string{}
+	found := map[string]bool{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var sum string
+		switch header.Typeflag {
+		case tar.TypeReg:
+			if sum, err = sha256Sum(tarReader); err != nil {
+				return 0, err
+			}
+		case tar.TypeSymlink:
+			sum = symlinkSum(header.Linkname)
+		default:
+			continue
+		}
+		found[header.Name] = true
+
+		if sums == nil {
+			continue
+		}
+
+		if expected, archived := sums[header.Name]; !archived {
+			problems = append(problems, fmt.Sprintf("%s was not archived", header.Name))
+		} else if sum != expected {
+			problems = append(problems, fmt.Sprintf("%s checksum mismatch", header.Name))
+		}
+	}
+
+	for name := range sums {
+		if !found[name] {
+			problems = append(problems, fmt.Sprintf("%s is missing", name))
+		}
+	}
+
+	//read whatever follows the end of the tar so that the whole file is hashed
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return 0, err
+	}
+
+	if sum := hex.EncodeToString(archiveHash.Sum(nil)); sum != expectedSum {
+		problems = append(problems, fmt.Sprintf("archive checksum %s does not match %s", sum, expectedSum))
+	}
+
+	if len(problems) > 0 {
+		return 0, errors.New(strings.Join(problems, "; "))
+	}
+
+	return len(found), nil
+}
+
+// readArchiveChecksum reads the sha256 of an archive from its `<archive>.sha256` sidecar
+func readArchiveChecksum(archiveFile string) (string, error) {
+	b, err := os.ReadFile(archiveFile + ".sha256")
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s.sha256 is empty", archiveFile)
+	}
+	return fields[0], nil
+}
+
+func extractProjectArchive(archiveFile string, target string) (int, error) {
+	f, err := os.Open(archiveFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+	defer gzipReader.Close()
+
+	if err := os.MkdirAll(target, 0775); err != nil {
+		return 0, err
+	}
+
+	//nothing is extracted through a restored symlink, which could point outside of the project
+	links := map[string]bool{}
+	numFiles := 0
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		name := path.Clean(header.Name)
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return 0, fmt.Errorf("%s contains %s, outside of the project", archiveFile, header.Name)
+		}
+		entryLoc := filepath.Join(target, filepath.FromSlash(name))
+
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			if links[parent] {
+				return 0, fmt.Errorf("%s contains %s, inside the symlink %s", archiveFile, header.Name, parent)
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(entryLoc, 0775); err != nil {
+				return 0, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(entryLoc), 0775); err != nil {
+				return 0, err
+			}
+
+			if _, err := writeAndHash(entryLoc, tarReader, header.FileInfo().Mode().Perm(), header.ModTime); err != nil {
+				return 0, err
+			}
+			numFiles++
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(entryLoc), 0775); err != nil {
+				return 0, err
+			}
+
+			if err := os.Symlink(header.Linkname, entryLoc); err != nil {
+				return 0, err
+			}
+			links[name] = true
+			numFiles++
+		default:
+			return 0, fmt.Errorf("%s contains %s, which is not a regular file, directory or symlink", archiveFile, header.Name)
+		}
+	}
+
+	return numFiles, nil
+}
@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// newArchiveProject writes a project holding a file and a symlink to it, returning the project and archive locations
+func newArchiveProject(t *testing.T) (string, string) {
+	t.Helper()
+
+	//keep the site and user configs on the host out of the tests
+	previousSiteConfigLoc := siteConfigLoc
+	t.Cleanup(func() { siteConfigLoc = previousSiteConfigLoc })
+	siteConfigLoc = ""
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("ERWT_PROJECT", "")
+
+	previous := config
+	t.Cleanup(func() { config = previous })
+
+	root := t.TempDir()
+	projectLoc := filepath.Join(root, "cc")
+	if err := os.MkdirAll(filepath.Join(projectLoc, "logs"), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(projectLoc, "config.yml"), []byte("collection-code: cc\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(projectLoc, "logs", "cc-transfer.log"), []byte("transferred\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(filepath.Join("logs", "cc-transfer.log"), filepath.Join(projectLoc, "latest.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	return projectLoc, filepath.Join(root, "completed")
+}
+
+func TestArchiveProjectSymlinks(t *testing.T) {
+	projectLoc, archiveLoc := newArchiveProject(t)
+
+	//the project has no work order, so does not reconcile
+	if err := ArchiveProject(ArchiveOptions{ProjectLoc: projectLoc, ArchiveLoc: archiveLoc, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(projectLoc); !os.IsNotExist(err) {
+		t.Fatalf("%s was not removed", projectLoc)
+	}
+
+	restoreLoc := t.TempDir()
+	if err := RestoreProject(filepath.Join(archiveLoc, "cc.tgz"), restoreLoc, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := os.Readlink(filepath.Join(restoreLoc, "cc", "latest.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := filepath.Join("logs", "cc-transfer.log"); link != want {
+		t.Errorf("got link to %s, want %s", link, want)
+	}
+
+	if b, err := os.ReadFile(filepath.Join(restoreLoc, "cc", "latest.log")); err != nil || string(b) != "transferred\n" {
+		t.Errorf("got %q reading through the restored link: %v", string(b), err)
+	}
+}
+
+func TestArchiveProjectUnarchivableFiles(t *testing.T) {
+	projectLoc, archiveLoc := newArchiveProject(t)
+
+	listener, err := net.Listen("unix", filepath.Join(projectLoc, "logs", "sock"))
+	if err != nil {
+		t.Skipf("can not create a unix socket: %s", err.Error())
+	}
+	defer listener.Close()
+
+	err = ArchiveProject(ArchiveOptions{ProjectLoc: projectLoc, ArchiveLoc: archiveLoc, Force: false})
+	if err == nil || !strings.Contains(err.Error(), "can not be archived") {
+		t.Fatalf("got %v, want the project refused for holding a socket", err)
+	}
+
+	if _, err := os.Stat(projectLoc); err != nil {
+		t.Fatalf("%s was removed: %s", projectLoc, err.Error())
+	}
+
+	if err := ArchiveProject(ArchiveOptions{ProjectLoc: projectLoc, ArchiveLoc: archiveLoc, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	restoreLoc := t.TempDir()
+	if err := RestoreProject(filepath.Join(archiveLoc, "cc.tgz"), restoreLoc, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(restoreLoc, "cc", archiveManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := archiveManifest{}
+	if err := yaml.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest.Skipped) != 1 || manifest.Skipped[0] != "logs/sock" {
+		t.Errorf("got skipped %v, want [logs/sock]", manifest.Skipped)
+	}
+}
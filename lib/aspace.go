@@ -6,30 +6,51 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
-	"os/user"
-	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/nyudlts/go-aspace"
-	"gopkg.in/yaml.v2"
 )
 
 var (
 	aspaceConfigLoc string
 	transferInfo    TransferInfo
 	aspaceEnv       string
+	aspaceStaffURL  string
+	aspacePublicURL string
 )
 
-func AspaceCheck() error {
+const (
+	defaultAspaceEnv      = "prod"
+	defaultAspaceStaffURL = "https://archivesspace.library.nyu.edu"
+)
+
+// AspaceOptions holds ArchivesSpace settings given on the command line, empty values
+// fall back to the project's config.yml and then to the defaults
+type AspaceOptions struct {
+	ConfigLoc   string
+	Environment string
+	StaffURL    string
+	PublicURL   string
+}
+
+func AspaceCheck(opts AspaceOptions, numWorkers int, requestsPerSecond int) error {
 
 	fmt.Printf("ewt aspace check, %s\n", VERSION)
 
+	//the rate limiter can not tick more often than once a nanosecond
+	if requestsPerSecond < 0 || requestsPerSecond > int(time.Second) {
+		return fmt.Errorf("--rps must be between 0 and %d, got %d", int(time.Second), requestsPerSecond)
+	}
+
 	if err := loadConfig(); err != nil {
 		return err
 	}
 
 	//get aspaceConfig
-	if err := getAspaceConfig(); err != nil {
+	if err := getAspaceConfig(opts); err != nil {
 		return err
 	}
 
@@ -44,20 +65,17 @@ func AspaceCheck() error {
 	}
 
 	//run the check
-	if err := aspaceCheck(); err != nil {
+	if err := aspaceCheck(numWorkers, requestsPerSecond); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func getAspaceConfig() error {
+func getAspaceConfig(opts AspaceOptions) error {
+	aspaceConfigLoc = firstNonEmpty(opts.ConfigLoc, config.AspaceConfigLoc)
 	if aspaceConfigLoc == "" {
-		currentUser, err := user.Current()
-		if err != nil {
-			return (err)
-		}
-		aspaceConfigLoc = fmt.Sprintf("/home/%s/.config/go-aspace.yml", currentUser.Username)
+		return fmt.Errorf("no go-aspace config, use --config or set `aspace-config` in config.yml")
 	}
 
 	_, err := os.Stat(aspaceConfigLoc)
@@ -65,26 +83,52 @@ func getAspaceConfig() error {
 		return err
 	}
 
-	aspaceEnv = "prod"
+	aspaceEnv = firstNonEmpty(opts.Environment, config.AspaceEnv, defaultAspaceEnv)
+	aspaceStaffURL = strings.TrimSuffix(firstNonEmpty(opts.StaffURL, config.AspaceStaffURL, defaultAspaceStaffURL), "/")
+	aspacePublicURL = strings.TrimSuffix(firstNonEmpty(opts.PublicURL, config.AspacePublicURL), "/")
 	return nil
 }
 
-func getTransferInfo() error {
-	transferInfo = TransferInfo{}
-	transferInfoLoc := filepath.Join(config.SIPLoc, "metadata", "transfer-info.txt")
-	transferInfoBytes, err := os.ReadFile(transferInfoLoc)
-	if err != nil {
-		return err
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
 	}
+	return ""
+}
 
-	if err := yaml.Unmarshal(transferInfoBytes, &transferInfo); err != nil {
-		return err
-	}
+func getTransferInfo() error {
+	var err error
+	transferInfo, err = currentProject().TransferInfo()
+	return err
+}
 
-	return nil
+// aspaceChecker checks work order rows against ArchivesSpace with a pool of workers,
+// sharing a rate limiter and a cache of digital object lookups
+type aspaceChecker struct {
+	client  *aspace.ASClient
+	limiter <-chan time.Time
+	doCache sync.Map
+}
+
+type doLookup struct {
+	once sync.Once
+	do   aspace.DigitalObject
+	err  error
+}
+
+type checkJob struct {
+	index int
+	row   aspace.WorkOrderRow
+}
+
+type checkResult struct {
+	index int
+	lines [][]string
 }
 
-func aspaceCheck() error {
+func aspaceCheck(numWorkers int, requestsPerSecond int) error {
 	client, err := aspace.NewClient(aspaceConfigLoc, aspaceEnv, 20)
 	if err != nil {
 		panic(err)
@@ -97,85 +141,276 @@ func aspaceCheck() error {
 		panic(err)
 	}
 
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	checker := &aspaceChecker{client: client}
+	if requestsPerSecond > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(requestsPerSecond))
+		defer ticker.Stop()
+		checker.limiter = ticker.C
+	}
+
+	//check the resource identifier before the rows
+	fmt.Print("  * checking resource identifier: ")
+	resourceMsg, err := checker.checkResource()
+	if err != nil {
+		return err
+	}
+	if resourceMsg != "" {
+		fmt.Printf("ERROR: %s\n", resourceMsg)
+	} else {
+		fmt.Println("OK")
+	}
+
+	fmt.Printf("  * checking %d work order rows with %d workers\n", len(wo.Rows), numWorkers)
+
+	jobs := make(chan checkJob)
+	resultChan := make(chan checkResult)
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				resultChan <- checkResult{job.index, checker.checkRow(job.row)}
+			}
+		}()
+	}
+
+	go func() {
+		for i, row := range wo.Rows {
+			jobs <- checkJob{i, row}
+		}
+		close(jobs)
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	//collect the results in work order row order
+	results := make([][][]string, len(wo.Rows))
+	for result := range resultChan {
+		results[result.index] = result.lines
+	}
+
 	var b bytes.Buffer
 	out := csv.NewWriter(bufio.NewWriter(&b))
 	out.Comma = '\t'
-	out.Write([]string{"ao_uri", "title", "do_uri", "do_id", "msg"})
+	out.Write([]string{"ao_uri", "title", "do_uri", "do_id", "msg", "public_url"})
+
+	summary := map[string]int{}
+	for _, lines := range results {
+		for _, line := range lines {
+			out.Write(line)
+			if line[4] == "OK" {
+				summary["OK"]++
+				continue
+			}
+			for _, msg := range strings.Split(strings.TrimPrefix(line[4], "ERROR: "), "; ") {
+				summary["ERROR: "+msg]++
+			}
+		}
+	}
 	out.Flush()
 
-	for _, row := range wo.Rows {
-		repoId, aoURI, err := aspace.URISplit(row.GetURI())
-		if err != nil {
-			return err
-		}
-		fmt.Printf("Checking %s: ", row.GetURI())
-
-		ao, err := client.GetArchivalObject(repoId, aoURI)
-		if err != nil {
-			fmt.Printf("[ERROR] AO does not exist: %s\n", row.GetURI())
-			out.Write([]string{row.GetURI(), "", "", "ERROR: AO does not exist: " + row.GetURI()})
-			out.Flush()
-			continue
-		}
+	checkFilename := currentProject().LogLoc("aspace-check.tsv")
 
-		instances := ao.Instances
+	if err := os.WriteFile(checkFilename, b.Bytes(), 0775); err != nil {
+		panic(err)
+	}
 
-		if len(instances) < 1 {
-			fmt.Printf("[ERROR] AO has no instances: %s\n", row.GetURI())
-			out.Write([]string{ao.URI, ao.Title, "ERROR: AO has no instances", ao.ComponentId, "KO"})
-			out.Flush()
-			continue
-		}
+	fmt.Println("aspace checkfile written to:", checkFilename)
+	if resourceMsg != "" {
+		summary["ERROR: "+resourceMsg]++
+	}
+	printCheckSummary(summary)
 
-		for _, instance := range instances {
-			if instance.InstanceType == "digital_object" {
-				doURI := instance.DigitalObject["ref"]
-				_, doID, err := aspace.URISplit(doURI)
-				if err != nil {
-					fmt.Printf("[ERROR] Not able to split: %s\n", doURI)
-					out.Write([]string{row.GetURI(), "", "", "ERROR: Not able to split: " + doURI})
-					out.Flush()
-					continue
-				}
+	return nil
 
-				do, err := client.GetDigitalObject(repoId, doID)
-				if err != nil {
-					fmt.Printf("[ERROR] not able to request: %s\n", doURI)
-					out.Write([]string{row.GetURI(), "", "", "ERROR: not able to request: " + doURI})
-					out.Flush()
-					continue
-				}
+}
 
-				if do.DigitalObjectID != row.GetComponentID() {
-					fmt.Printf("[ERROR] Component IDs do not match: %s, %s, %s\n", row.GetURI(), do.URI, do.DigitalObjectID)
-					out.Write([]string{row.GetURI(), do.URI, do.DigitalObjectID, "ERROR: component IDs do not match"})
-					out.Flush()
-					continue
-				} else {
-					aoURI := row.GetURI()
-					fmt.Println("OK")
-					resourceID := transferInfo.GetResourceID()
-					aspaceURI := fmt.Sprintf("https://archivesspace.library.nyu.edu/resources/%s#tree::archival_object_%s", resourceID, getAspaceID(aoURI))
-					doIdentifier := getAspaceID(doURI)
-					aspaceDOURI := fmt.Sprintf("https://archivesspace.library.nyu.edu/digital_objects/%s#tree::digital_object_%s", doIdentifier, doIdentifier)
-					out.Write([]string{aspaceURI, do.Title, aspaceDOURI, do.DigitalObjectID, "OK"})
-					out.Flush()
-					continue
+func (c *aspaceChecker) wait() {
+	if c.limiter != nil {
+		<-c.limiter
+	}
+}
+
+func (c *aspaceChecker) getDigitalObject(repoID int, doID int) (aspace.DigitalObject, error) {
+	key := fmt.Sprintf("%d/%d", repoID, doID)
+	entry, _ := c.doCache.LoadOrStore(key, &doLookup{})
+	lookup := entry.(*doLookup)
+	lookup.once.Do(func() {
+		c.wait()
+		lookup.do, lookup.err = c.client.GetDigitalObject(repoID, doID)
+	})
+	return lookup.do, lookup.err
+}
+
+func (c *aspaceChecker) checkRow(row aspace.WorkOrderRow) [][]string {
+	repoId, aoURI, err := aspace.URISplit(row.GetURI())
+	if err != nil {
+		fmt.Printf("[ERROR] Not able to split: %s\n", row.GetURI())
+		return [][]string{{row.GetURI(), "", "", "", "ERROR: Not able to split", ""}}
+	}
+
+	c.wait()
+	ao, err := c.client.GetArchivalObject(repoId, aoURI)
+	if err != nil {
+		fmt.Printf("[ERROR] AO does not exist: %s\n", row.GetURI())
+		return [][]string{{row.GetURI(), "", "", "", "ERROR: AO does not exist", ""}}
+	}
+
+	aoErrs := checkArchivalObject(row, ao)
+
+	instances := ao.Instances
+
+	if len(instances) < 1 {
+		fmt.Printf("[ERROR] AO has no instances: %s\n", row.GetURI())
+		return [][]string{{ao.URI, ao.Title, "", ao.ComponentId, checkMessage(append([]string{"AO has no instances"}, aoErrs...)), ""}}
+	}
+
+	lines := [][]string{}
+	for _, instance := range instances {
+		if instance.InstanceType == "digital_object" {
+			doURI := instance.DigitalObject["ref"]
+			_, doID, err := aspace.URISplit(doURI)
+			if err != nil {
+				fmt.Printf("[ERROR] Not able to split: %s\n", doURI)
+				lines = append(lines, []string{row.GetURI(), "", doURI, "", "ERROR: Not able to split", ""})
+				continue
+			}
+
+			do, err := c.getDigitalObject(repoId, doID)
+			if err != nil {
+				fmt.Printf("[ERROR] not able to request: %s\n", doURI)
+				lines = append(lines, []string{row.GetURI(), "", doURI, "", "ERROR: not able to request", ""})
+				continue
+			}
+
+			errs := append(append([]string{}, aoErrs...), checkDigitalObject(row, ao, do)...)
+			if len(errs) > 0 {
+				fmt.Printf("[ERROR] %s, %s: %s\n", row.GetURI(), do.URI, strings.Join(errs, "; "))
+				lines = append(lines, []string{row.GetURI(), do.Title, do.URI, do.DigitalObjectID, checkMessage(errs), ""})
+				continue
+			} else {
+				aoURI := row.GetURI()
+				fmt.Printf("Checking %s: OK\n", aoURI)
+				resourceID := transferInfo.GetResourceID()
+				aspaceURI := fmt.Sprintf("%s/resources/%s#tree::archival_object_%s", aspaceStaffURL, resourceID, getAspaceID(aoURI))
+				doIdentifier := getAspaceID(doURI)
+				aspaceDOURI := fmt.Sprintf("%s/digital_objects/%s#tree::digital_object_%s", aspaceStaffURL, doIdentifier, doIdentifier)
+				publicURI := ""
+				if aspacePublicURL != "" {
+					publicURI = aspacePublicURL + aoURI
 				}
+				lines = append(lines, []string{aspaceURI, do.Title, aspaceDOURI, do.DigitalObjectID, "OK", publicURI})
+				continue
 			}
 		}
 	}
 
-	checkFilename := filepath.Join("logs", fmt.Sprintf("%s-aspace-check.tsv", config.CollectionCode))
+	if len(lines) < 1 {
+		fmt.Printf("[ERROR] AO has no digital object instances: %s\n", row.GetURI())
+		lines = append(lines, []string{ao.URI, ao.Title, "", ao.ComponentId, checkMessage(append([]string{"AO has no digital object instances"}, aoErrs...)), ""})
+	}
 
-	if err := os.WriteFile(checkFilename, b.Bytes(), 0775); err != nil {
-		panic(err)
+	return lines
+}
+
+// checkArchivalObject compares the AO with its work order row and transfer-info.txt
+func checkArchivalObject(row aspace.WorkOrderRow, ao aspace.ArchivalObject) []string {
+	errs := []string{}
+
+	title := normalizeTitle(row.GetTitle())
+	if title != normalizeTitle(ao.Title) && title != normalizeTitle(ao.DisplayString) {
+		errs = append(errs, "titles do not match")
 	}
 
-	fmt.Println("aspace checkfile written to:", checkFilename)
+	if ao.Resource["ref"] != transferInfo.ArchivesSpaceResourceURL {
+		errs = append(errs, "AO is not part of resource")
+	}
 
-	return nil
+	return errs
+}
+
+// checkDigitalObject checks the DO linked to an AO against its work order row and the content classification
+func checkDigitalObject(row aspace.WorkOrderRow, ao aspace.ArchivalObject, do aspace.DigitalObject) []string {
+	errs := []string{}
 
+	if do.DigitalObjectID != row.GetComponentID() {
+		errs = append(errs, "component IDs do not match")
+	}
+
+	if do.Suppressed {
+		errs = append(errs, "DO is suppressed")
+	}
+
+	for _, linkedInstance := range do.LinkedInstances {
+		if linkedInstance.Ref != ao.URI {
+			errs = append(errs, "DO is linked to another AO")
+			break
+		}
+	}
+
+	switch transferInfo.ContentClassification {
+	case "open":
+		if !do.Publish || do.Restrictions {
+			errs = append(errs, "DO publish/restrictions do not match content classification")
+		}
+	case "closed":
+		if do.Publish || !do.Restrictions {
+			errs = append(errs, "DO publish/restrictions do not match content classification")
+		}
+	case "restricted":
+		if !do.Restrictions {
+			errs = append(errs, "DO publish/restrictions do not match content classification")
+		}
+	}
+
+	return errs
+}
+
+// checkResource compares the identifier of the resource in transfer-info.txt with `nyu-dl-resource-id`
+func (c *aspaceChecker) checkResource() (string, error) {
+	repoID, resourceID, err := aspace.URISplit(transferInfo.ArchivesSpaceResourceURL)
+	if err != nil {
+		return "", err
+	}
+
+	c.wait()
+	resource, err := c.client.GetResource(repoID, resourceID)
+	if err != nil {
+		return "", err
+	}
+
+	identifier := resource.MergeIDs(".")
+	if !strings.EqualFold(identifier, transferInfo.ResourceID) {
+		return fmt.Sprintf("resource identifier %s does not match nyu-dl-resource-id %s", identifier, transferInfo.ResourceID), nil
+	}
+
+	return "", nil
+}
+
+func normalizeTitle(title string) string {
+	return strings.Join(strings.Fields(title), " ")
+}
+
+func checkMessage(errs []string) string {
+	return "ERROR: " + strings.Join(errs, "; ")
+}
+
+func printCheckSummary(summary map[string]int) {
+	msgs := []string{}
+	for msg := range summary {
+		msgs = append(msgs, msg)
+	}
+	sort.Strings(msgs)
+
+	fmt.Println("aspace check summary:")
+	for _, msg := range msgs {
+		fmt.Printf("  * %s: %d\n", msg, summary[msg])
+	}
 }
 
 func getAspaceID(aoURI string) string {
@@ -0,0 +1,157 @@
+package lib
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyudlts/electronic-records-workflow-tool/lib/aspacestub"
+)
+
+// newStubProject creates a project whose sip metadata holds the stub's transfer-info.txt, and a go-aspace config
+// pointing at a stand-in ArchivesSpace served with httptest, wrap, if given, intercepts requests to the stub
+func newStubProject(t *testing.T, wrap func(http.Handler) http.Handler) (string, AspaceOptions) {
+	t.Helper()
+
+	//keep the site and user configs on the host out of the tests
+	previousSiteConfigLoc := siteConfigLoc
+	t.Cleanup(func() { siteConfigLoc = previousSiteConfigLoc })
+	siteConfigLoc = ""
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("ERWT_PROJECT", "")
+
+	fixtures, err := aspacestub.DefaultFixtures()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub, err := aspacestub.NewServer(fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var handler http.Handler = stub
+	if wrap != nil {
+		handler = wrap(stub)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	stub.URL = server.URL
+
+	projectLoc := t.TempDir()
+	mdDir := filepath.Join(projectLoc, "sip", "metadata")
+	for _, dir := range []string{mdDir, filepath.Join(projectLoc, "logs")} {
+		if err := os.MkdirAll(dir, 0775); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(projectLoc, "config.yml"), []byte("collection-code: stub\naspace-files-extent-type: digital_files\naspace-size-extent-type: megabytes\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := aspacestub.WriteFixtureFile("transfer-info.txt", filepath.Join(mdDir, "transfer-info.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	configLoc := filepath.Join(projectLoc, "go-aspace.yml")
+	if err := stub.WriteConfig(configLoc); err != nil {
+		t.Fatal(err)
+	}
+
+	SetProject(projectLoc)
+	t.Cleanup(func() { SetProject("") })
+
+	return projectLoc, AspaceOptions{ConfigLoc: configLoc, Environment: aspacestub.Environment}
+}
+
+// writeStubWorkOrder writes a work order holding the rows of the stub's work order for the given component ids
+func writeStubWorkOrder(t *testing.T, projectLoc string, componentIDs ...string) {
+	t.Helper()
+
+	workOrderLoc := filepath.Join(projectLoc, "sip", "metadata", "stub_aspace_wo.tsv")
+	if err := aspacestub.WriteFixtureFile("stub_aspace_wo.tsv", workOrderLoc); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(workOrderLoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	rows := []string{lines[0]}
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		for _, componentID := range componentIDs {
+			if fields[len(fields)-1] == componentID {
+				rows = append(rows, line)
+			}
+		}
+	}
+
+	if err := os.WriteFile(workOrderLoc, []byte(strings.Join(rows, "\n")+"\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAspaceCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		componentID string
+		want        string
+	}{
+		{"matching DO", "ER_1", "OK"},
+		{"AO without instances", "ER_2", "ERROR: AO has no instances"},
+		{"unsplittable DO uri", "ER_3", "ERROR: Not able to split"},
+		{"component id mismatch", "ER_4", "ERROR: component IDs do not match"},
+		{"missing AO", "ER_5", "ERROR: AO does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectLoc, opts := newStubProject(t, nil)
+			writeStubWorkOrder(t, projectLoc, tt.componentID)
+
+			if err := AspaceCheck(opts, 1, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			reportFile, err := os.Open(filepath.Join(projectLoc, "logs", "stub-aspace-check.tsv"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reportFile.Close()
+
+			reader := csv.NewReader(reportFile)
+			reader.Comma = '\t'
+			records, err := reader.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(records) != 2 {
+				t.Fatalf("got %d report rows, want 1", len(records)-1)
+			}
+
+			if msg := records[1][4]; msg != tt.want {
+				t.Errorf("got msg %q, want %q", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestAspaceCheckRequestsPerSecond(t *testing.T) {
+	for _, rps := range []int{-1, int(time.Second) + 1} {
+		err := AspaceCheck(AspaceOptions{}, 1, rps)
+		if err == nil || !strings.Contains(err.Error(), "--rps") {
+			t.Errorf("got %v for %d requests per second, want it rejected", err, rps)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+// Package aspacestub is a stand-in ArchivesSpace server for testing the aspace commands offline,
+// it serves records seeded from fixture json and keeps created and updated records in memory.
+package aspacestub
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed fixtures
+var fixturesFS embed.FS
+
+const (
+	Environment  = "stub"
+	SessionKey   = "stub-session"
+	waypointSize = 200
+)
+
+var (
+	loginPtn      = regexp.MustCompile(`^/users/[^/]+/login$`)
+	treeRootPtn   = regexp.MustCompile(`^(/repositories/\d+/resources/\d+)/tree/root$`)
+	waypointPtn   = regexp.MustCompile(`^(/repositories/\d+/resources/\d+)/tree/waypoint$`)
+	collectionPtn = regexp.MustCompile(`^/repositories/(\d+)/(archival_objects|digital_objects|resources|top_containers)$`)
+)
+
+// Server is a stand-in ArchivesSpace backend, an http.Handler to serve with httptest
+type Server struct {
+	//URL is where the server is served, written to the go-aspace config by WriteConfig
+	URL     string
+	records map[string]map[string]interface{}
+	mutex   sync.Mutex
+	nextID  int
+}
+
+// DefaultFixtures returns the records embedded with the stub: a resource with an AO that checks OK, an AO
+// with no instances, an AO with an unsplittable DO uri and an AO whose DO has a different component id, and the stock
+// extent_extent_type enumeration with a local digital_files value
+func DefaultFixtures() (map[string]json.RawMessage, error) {
+	sub, err := fs.Sub(fixturesFS, "fixtures")
+	if err != nil {
+		return nil, err
+	}
+	return loadFixtures(sub)
+}
+
+func loadFixtures(fsys fs.FS) (map[string]json.RawMessage, error) {
+	records := map[string]json.RawMessage{}
+	matches, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, match := range matches {
+		b, err := fs.ReadFile(fsys, match)
+		if err != nil {
+			return nil, err
+		}
+
+		fixture := map[string]json.RawMessage{}
+		if err := json.Unmarshal(b, &fixture); err != nil {
+			return nil, fmt.Errorf("could not parse fixture %s: %w", match, err)
+		}
+
+		for uri, record := range fixture {
+			records[uri] = record
+		}
+	}
+
+	return records, nil
+}
+
+// WriteFixtureFile copies an embedded fixture, such as the work order or transfer-info.txt, to a location
+func WriteFixtureFile(name string, target string) error {
+	b, err := fixturesFS.ReadFile(path.Join("fixtures", name))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(target, b, 0664)
+}
+
+// NewServer creates a stand-in server seeded with records
+func NewServer(fixtures map[string]json.RawMessage) (*Server, error) {
+	s := &Server{records: map[string]map[string]interface{}{}, nextID: 1000}
+	for uri, raw := range fixtures {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return nil, fmt.Errorf("could not parse record %s: %w", uri, err)
+		}
+		s.records[uri] = record
+	}
+	return s, nil
+}
+
+// WriteConfig writes a go-aspace config with a `stub` environment pointing at the server
+func (s *Server) WriteConfig(configLoc string) error {
+	creds := map[string]map[string]string{
+		Environment: {"url": s.URL, "username": "admin", "password": "admin"},
+	}
+	b, err := yaml.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(configLoc), 0775); err != nil {
+		return err
+	}
+	return os.WriteFile(configLoc, b, 0600)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	uri := r.URL.Path
+
+	if r.Method == http.MethodPost && loginPtn.MatchString(uri) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"session": SessionKey})
+		return
+	}
+
+	if r.Header.Get("X-ArchivesSpace-Session") != SessionKey {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Access denied"})
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		if m := treeRootPtn.FindStringSubmatch(uri); m != nil {
+			s.serveTreeRoot(w, m[1])
+			return
+		}
+		if m := waypointPtn.FindStringSubmatch(uri); m != nil {
+			s.serveWaypoint(w, r, m[1])
+			return
+		}
+		record, ok := s.records[uri]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Record not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, record)
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		record := map[string]interface{}{}
+		if err := json.Unmarshal(body, &record); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if msg := s.invalidExtentType(record); msg != "" {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": map[string][]string{"extents": {msg}}})
+			return
+		}
+
+		if collectionPtn.MatchString(uri) {
+			s.nextID++
+			newURI := fmt.Sprintf("%s/%d", uri, s.nextID)
+			record["uri"] = newURI
+			record["lock_version"] = 0
+			s.records[newURI] = record
+			writeJSON(w, http.StatusOK, map[string]interface{}{"status": "Created", "id": s.nextID, "lock_version": 0, "uri": newURI, "warnings": []string{}})
+			return
+		}
+
+		existing, ok := s.records[uri]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Record not found"})
+			return
+		}
+		lockVersion, _ := existing["lock_version"].(float64)
+		record["uri"] = uri
+		record["lock_version"] = lockVersion + 1
+		s.records[uri] = record
+		id, _ := strconv.Atoi(path.Base(uri))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "Updated", "id": id, "lock_version": lockVersion + 1, "uri": uri, "warnings": []string{}})
+
+	case http.MethodDelete:
+		if _, ok := s.records[uri]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Record not found"})
+			return
+		}
+		delete(s.records, uri)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "Deleted", "uri": uri})
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+}
+
+// invalidExtentType checks the extent types of a record against the extent_extent_type enumeration, when the fixtures
+// hold it, as ArchivesSpace does
+func (s *Server) invalidExtentType(record map[string]interface{}) string {
+	enum, ok := s.records["/config/enumerations/names/extent_extent_type"]
+	if !ok {
+		return ""
+	}
+
+	values := map[string]bool{}
+	enumValues, _ := enum["values"].([]interface{})
+	for _, value := range enumValues {
+		values[fmt.Sprint(value)] = true
+	}
+
+	extents, _ := record["extents"].([]interface{})
+	for _, e := range extents {
+		extent, _ := e.(map[string]interface{})
+		if extentType := fmt.Sprint(extent["extent_type"]); !values[extentType] {
+			return fmt.Sprintf("Invalid value '%s'. Must be one of the extent_extent_type enumeration", extentType)
+		}
+	}
+	return ""
+}
+
+// children returns the uris of the AOs directly below a resource or AO, ordered by position
+func (s *Server) children(resourceURI string, parentURI string) []string {
+	type child struct {
+		uri      string
+		position float64
+	}
+	children := []child{}
+	for uri, record := range s.records {
+		if record["jsonmodel_type"] != "archival_object" || refOf(record["resource"]) != resourceURI || refOf(record["parent"]) != parentURI {
+			continue
+		}
+		position, _ := record["position"].(float64)
+		children = append(children, child{uri, position})
+	}
+
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].position == children[j].position {
+			return children[i].uri < children[j].uri
+		}
+		return children[i].position < children[j].position
+	})
+
+	uris := []string{}
+	for _, c := range children {
+		uris = append(uris, c.uri)
+	}
+	return uris
+}
+
+func (s *Server) node(resourceURI string, uri string, position int) map[string]interface{} {
+	record := s.records[uri]
+	childCount := len(s.children(resourceURI, uri))
+	return map[string]interface{}{
+		"uri":            uri,
+		"title":          record["title"],
+		"level":          record["level"],
+		"identifier":     record["component_id"],
+		"position":       position,
+		"jsonmodel_type": record["jsonmodel_type"],
+		"child_count":    childCount,
+		"waypoints":      (childCount + waypointSize - 1) / waypointSize,
+		"waypoint_size":  waypointSize,
+	}
+}
+
+func (s *Server) serveTreeRoot(w http.ResponseWriter, resourceURI string) {
+	if _, ok := s.records[resourceURI]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Record not found"})
+		return
+	}
+
+	root := s.node(resourceURI, resourceURI, 0)
+	root["child_count"] = len(s.children(resourceURI, ""))
+	root["waypoints"] = (root["child_count"].(int) + waypointSize - 1) / waypointSize
+
+	first := []map[string]interface{}{}
+	for i, uri := range s.waypoint(resourceURI, "", 0) {
+		first = append(first, s.node(resourceURI, uri, i))
+	}
+	root["precomputed_waypoints"] = map[string]interface{}{"": map[string]interface{}{"0": first}}
+
+	writeJSON(w, http.StatusOK, root)
+}
+
+func (s *Server) serveWaypoint(w http.ResponseWriter, r *http.Request, resourceURI string) {
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "offset is required"})
+		return
+	}
+
+	parentURI := r.URL.Query().Get("parent_node")
+	nodes := []map[string]interface{}{}
+	for i, uri := range s.waypoint(resourceURI, parentURI, offset) {
+		nodes = append(nodes, s.node(resourceURI, uri, offset*waypointSize+i))
+	}
+	writeJSON(w, http.StatusOK, nodes)
+}
+
+func (s *Server) waypoint(resourceURI string, parentURI string, offset int) []string {
+	children := s.children(resourceURI, parentURI)
+	start := offset * waypointSize
+	if start >= len(children) {
+		return []string{}
+	}
+	end := start + waypointSize
+	if end > len(children) {
+		end = len(children)
+	}
+	return children[start:end]
+}
+
+func refOf(v interface{}) string {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	ref, _ := m["ref"].(string)
+	return strings.TrimSpace(ref)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
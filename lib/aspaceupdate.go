@@ -0,0 +1,456 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nyudlts/go-aspace"
+)
+
+// AspaceUpdateOptions holds the settings for `aspace update`
+type AspaceUpdateOptions struct {
+	AIPFileLoc string
+	URIPattern string
+	DryRun     bool
+}
+
+type aipRecord struct {
+	ComponentID string
+	UUID        string
+	Path        string
+	NumFiles    int
+	Size        int64
+}
+
+type aspaceChange struct {
+	URI      string
+	Field    string
+	OldValue string
+	NewValue string
+}
+
+// extentTypes are the values of ArchivesSpace's extent_extent_type enumeration used for the file count and size of an
+// AO
+type extentTypes struct {
+	Files string
+	Size  string
+}
+
+// sizeExtentUnits are the size extent types aspace update can record, with the number of bytes in each
+var sizeExtentUnits = map[string]int64{"bytes": 1, "kilobytes": 1e3, "megabytes": 1e6, "gigabytes": 1e9, "terabytes": 1e12}
+
+// extentTypeEnumURI lists the extent types an ArchivesSpace instance accepts
+const extentTypeEnumURI = "/config/enumerations/names/extent_extent_type"
+
+func AspaceUpdate(opts AspaceOptions, updateOpts AspaceUpdateOptions) error {
+	fmt.Printf("ewt aspace update, %s\n", VERSION)
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	//get aspaceConfig
+	if err := getAspaceConfig(opts); err != nil {
+		return err
+	}
+
+	//get workorder
+	if err := findWorkOrder(); err != nil {
+		return err
+	}
+
+	//get transfer info
+	if err := getTransferInfo(); err != nil {
+		return err
+	}
+
+	uriPattern := firstNonEmpty(updateOpts.URIPattern, config.RstarURIPattern)
+	if uriPattern == "" {
+		return fmt.Errorf("no R* uri pattern set, use --uri-pattern or set `rstar-uri-pattern` in config.yml")
+	}
+
+	types, err := getExtentTypes()
+	if err != nil {
+		return err
+	}
+
+	aipFileLoc := updateOpts.AIPFileLoc
+	if aipFileLoc == "" {
+		var err error
+		aipFileLoc, err = findAIPFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	//get the size of each ER in the aip-file
+	aips, err := getAIPRecords(aipFileLoc)
+	if err != nil {
+		return err
+	}
+
+	//update the records in ArchivesSpace
+	if err := updateAspaceRecords(aips, uriPattern, types, updateOpts.DryRun); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getExtentTypes returns the extent types set in config.yml, there are no defaults as the file count has no type in a
+// stock ArchivesSpace
+func getExtentTypes() (extentTypes, error) {
+	types := extentTypes{Files: config.FilesExtentType, Size: config.SizeExtentType}
+	if types.Files == "" || types.Size == "" {
+		return types, fmt.Errorf("set `aspace-files-extent-type` and `aspace-size-extent-type` in config.yml to values of ArchivesSpace's extent_extent_type enumeration")
+	}
+
+	if _, found := sizeExtentUnits[types.Size]; !found {
+		units := []string{}
+		for unit := range sizeExtentUnits {
+			units = append(units, unit)
+		}
+		sort.Strings(units)
+		return types, fmt.Errorf("aspace-size-extent-type %q is not one of %s", types.Size, strings.Join(units, ", "))
+	}
+
+	return types, nil
+}
+
+// checkExtentTypes checks that ArchivesSpace accepts the extent types before any record is updated
+func checkExtentTypes(client *aspace.ASClient, types extentTypes) error {
+	enum := struct {
+		Values []string `json:"values"`
+	}{}
+	if _, err := getRecordJSON(client, extentTypeEnumURI, &enum); err != nil {
+		return fmt.Errorf("could not get the extent_extent_type enumeration: %w", err)
+	}
+
+	for _, extentType := range []string{types.Files, types.Size} {
+		if !slices.Contains(enum.Values, extentType) {
+			return fmt.Errorf("extent type %q is not in ArchivesSpace's extent_extent_type enumeration: %s", extentType, strings.Join(enum.Values, ", "))
+		}
+	}
+
+	return nil
+}
+
+// getAIPRecords reads the aip-file and counts the files and bytes of each ER, using the staged copy in the
+// aips directory when present and the Archivematica AIP store otherwise
+func getAIPRecords(aipFileLoc string) (map[string]aipRecord, error) {
+	aipFile, err := os.Open(aipFileLoc)
+	if err != nil {
+		return nil, err
+	}
+	defer aipFile.Close()
+
+	aips := map[string]aipRecord{}
+	scanner := bufio.NewScanner(aipFile)
+	for scanner.Scan() {
+		aipPath := strings.TrimSpace(scanner.Text())
+		if aipPath == "" {
+			continue
+		}
+
+		componentID, aipUUID, err := parseAIPName(filepath.Base(aipPath))
+		if err != nil {
+			return nil, err
+		}
+
+		stagedPath := filepath.Join(config.AIPLoc, filepath.Base(aipPath))
+		if _, err := os.Stat(stagedPath); err == nil {
+			aipPath = stagedPath
+		}
+
+		erPath := filepath.Join(aipPath, "data", "objects", componentID)
+		if _, err := os.Stat(erPath); err != nil {
+			erPath = filepath.Join(aipPath, "data", "objects")
+		}
+
+		numFiles, size, err := getDirectorySize(erPath)
+		if err != nil {
+			return nil, err
+		}
+
+		aips[componentID] = aipRecord{componentID, aipUUID, aipPath, numFiles, size}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return aips, nil
+}
+
+func expandURIPattern(pattern string, aip aipRecord) string {
+	replacer := strings.NewReplacer(
+		"{component-id}", aip.ComponentID,
+		"{aip-uuid}", aip.UUID,
+		"{collection-code}", config.CollectionCode,
+		"{rstar-collection-id}", transferInfo.RStarCollectionID,
+	)
+	return replacer.Replace(pattern)
+}
+
+func updateAspaceRecords(aips map[string]aipRecord, uriPattern string, types extentTypes, dryRun bool) (err error) {
+	client, err := aspace.NewClient(aspaceConfigLoc, aspaceEnv, 20)
+	if err != nil {
+		return err
+	}
+
+	if err := checkExtentTypes(client, types); err != nil {
+		return err
+	}
+
+	wo, err := parseWorkOrder(filepath.Dir(workOrderLocation), filepath.Base(workOrderLocation))
+	if err != nil {
+		return err
+	}
+
+	backupDir := filepath.Join(config.LogLoc, "aspace-backup")
+	if !dryRun {
+		if err := os.MkdirAll(backupDir, 0775); err != nil {
+			return err
+		}
+	}
+
+	changes := []aspaceChange{}
+
+	//log the changes applied in ArchivesSpace so far, including when a later update fails
+	if !dryRun {
+		defer func() {
+			if logErr := writeChangeLog(changes, backupDir); err == nil {
+				err = logErr
+			}
+		}()
+	}
+
+	for _, row := range wo.Rows {
+		componentID := row.GetComponentID()
+		aip, ok := aips[componentID]
+		if !ok {
+			fmt.Printf("  * [WARNING] %s is not in the aip-file, skipping\n", componentID)
+			continue
+		}
+
+		repoID, aoID, err := aspace.URISplit(row.GetURI())
+		if err != nil {
+			return err
+		}
+
+		ao := aspace.ArchivalObject{}
+		aoJSON, err := getRecordJSON(client, row.GetURI(), &ao)
+		if err != nil {
+			return err
+		}
+
+		doURI, err := findMatchingDO(client, ao, componentID)
+		if err != nil {
+			return err
+		}
+		if doURI == "" {
+			fmt.Printf("  * [WARNING] %s has no digital object, run `aspace create-dos` first\n", componentID)
+			continue
+		}
+
+		_, doID, err := aspace.URISplit(doURI)
+		if err != nil {
+			return err
+		}
+
+		do := aspace.DigitalObject{}
+		doJSON, err := getRecordJSON(client, doURI, &do)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("  * %s: %d files, %d bytes\n", componentID, aip.NumFiles, aip.Size)
+
+		//update the extents on the AO first, it is the update ArchivesSpace is more likely to reject
+		aoChanges := setExtents(&ao, aip.NumFiles, aip.Size, types)
+		if len(aoChanges) > 0 && !dryRun {
+			if err := writeBackup(backupDir, ao.URI, aoJSON); err != nil {
+				return err
+			}
+			if _, err := client.UpdateArchivalObject(repoID, aoID, ao); err != nil {
+				return err
+			}
+		}
+		changes = append(changes, aoChanges...)
+
+		//update the file version on the DO
+		doChanges := setFileVersion(&do, expandURIPattern(uriPattern, aip), aip.Size)
+		if len(doChanges) > 0 && !dryRun {
+			if err := writeBackup(backupDir, doURI, doJSON); err != nil {
+				return err
+			}
+			if _, err := client.UpdateDigitalObject(repoID, doID, do); err != nil {
+				return err
+			}
+		}
+		changes = append(changes, doChanges...)
+	}
+
+	prefix := ""
+	if dryRun {
+		prefix = "[DRY-RUN] "
+	}
+	for _, change := range changes {
+		fmt.Printf("  * %s%s %s: %q -> %q\n", prefix, change.URI, change.Field, change.OldValue, change.NewValue)
+	}
+
+	return nil
+}
+
+// getRecordJSON requests an ArchivesSpace record, returning its json and unmarshalling it into v
+func getRecordJSON(client *aspace.ASClient, uri string, v interface{}) ([]byte, error) {
+	response, err := client.GetEndpoint(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+func setFileVersion(do *aspace.DigitalObject, fileURI string, size int64) []aspaceChange {
+	useStatement := transferInfo.UseStatement
+	if useStatement == "" {
+		useStatement = "electronic-records-reading-room"
+	}
+
+	for i, fileVersion := range do.FileVersions {
+		if fileVersion.UseStatement != useStatement {
+			continue
+		}
+
+		changes := []aspaceChange{}
+		if fileVersion.FileURI != fileURI {
+			changes = append(changes, aspaceChange{do.URI, "file_uri", fileVersion.FileURI, fileURI})
+			do.FileVersions[i].FileURI = fileURI
+		}
+		if fileVersion.FileSizeBytes != uint64(size) {
+			changes = append(changes, aspaceChange{do.URI, "file_size_bytes", strconv.FormatUint(fileVersion.FileSizeBytes, 10), strconv.FormatInt(size, 10)})
+			do.FileVersions[i].FileSizeBytes = uint64(size)
+		}
+		return changes
+	}
+
+	do.FileVersions = append(do.FileVersions, aspace.FileVersion{
+		FileURI:       fileURI,
+		FileSizeBytes: uint64(size),
+		UseStatement:  useStatement,
+		Publish:       do.Publish,
+		JSONModelType: "file_version",
+	})
+
+	return []aspaceChange{{do.URI, "file_version", "", fileURI}}
+}
+
+func setExtents(ao *aspace.ArchivalObject, numFiles int, size int64, types extentTypes) []aspaceChange {
+	changes := []aspaceChange{}
+	extents := [][2]string{{types.Files, strconv.Itoa(numFiles)}, {types.Size, formatExtentSize(size, types.Size)}}
+	for _, e := range extents {
+		extentType, number := e[0], e[1]
+		found := false
+		for i, extent := range ao.Extents {
+			if extent.ExtentType != extentType {
+				continue
+			}
+			found = true
+			if extent.Number != number {
+				changes = append(changes, aspaceChange{ao.URI, "extent " + extentType, extent.Number, number})
+				ao.Extents[i].Number = number
+			}
+			break
+		}
+
+		if !found {
+			ao.Extents = append(ao.Extents, aspace.Extent{
+				Portion:       "whole",
+				Number:        number,
+				ExtentType:    extentType,
+				JSONModelType: "extent",
+			})
+			changes = append(changes, aspaceChange{ao.URI, "extent " + extentType, "", number})
+		}
+	}
+	return changes
+}
+
+// formatExtentSize writes a size in bytes in the unit of the size extent type, to two decimal places for units larger
+// than bytes
+func formatExtentSize(size int64, sizeType string) string {
+	unit := sizeExtentUnits[sizeType]
+	if unit <= 1 {
+		return strconv.FormatInt(size, 10)
+	}
+	return strconv.FormatFloat(float64(size)/float64(unit), 'f', 2, 64)
+}
+
+// writeBackup stores the json of a record before it is updated, so the change can be reverted
+func writeBackup(backupDir string, uri string, recordJSON []byte) error {
+	backupLoc := filepath.Join(backupDir, backupName(uri))
+
+	//keep the earliest backup of a record
+	if _, err := os.Stat(backupLoc); err == nil {
+		return nil
+	}
+
+	return os.WriteFile(backupLoc, recordJSON, 0664)
+}
+
+func backupName(uri string) string {
+	return strings.ReplaceAll(strings.Trim(uri, "/"), "/", "_") + ".json"
+}
+
+func writeChangeLog(changes []aspaceChange, backupDir string) error {
+	changeLogLoc := currentProject().LogLoc("aspace-update.tsv")
+	changeLog, err := os.OpenFile(changeLogLoc, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0664)
+	if err != nil {
+		return err
+	}
+	defer changeLog.Close()
+
+	info, err := changeLog.Stat()
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(changeLog)
+	writer.Comma = '\t'
+	if info.Size() == 0 {
+		writer.Write([]string{"timestamp", "uri", "field", "old_value", "new_value", "backup"})
+	}
+
+	timestamp := time.Now().Format(time.RFC3339)
+	for _, change := range changes {
+		writer.Write([]string{timestamp, change.URI, change.Field, change.OldValue, change.NewValue, filepath.Join(backupDir, backupName(change.URI))})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	fmt.Printf("  * %d changes written to %s\n", len(changes), changeLogLoc)
+	return nil
+}
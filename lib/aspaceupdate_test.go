@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failPosts fails the updates to the records whose uris contain recordType
+func failPosts(recordType string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/"+recordType+"/") {
+				http.Error(w, `{"error": "stub failure"}`, http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestAspaceUpdate(t *testing.T) {
+	const (
+		aoURI = "/repositories/2/archival_objects/1\t"
+		doURI = "/repositories/2/digital_objects/1\t"
+	)
+
+	tests := []struct {
+		name          string
+		wrap          func(http.Handler) http.Handler
+		filesType     string
+		wantErr       string
+		wantLogged    []string
+		wantNotLogged []string
+	}{
+		{"updates the AO and DO", nil, "", "", []string{aoURI + "extent digital_files\t\t1", aoURI + "extent megabytes\t\t0.00", doURI + "file_version"}, nil},
+		{"DO update fails", failPosts("digital_objects"), "", "500", []string{aoURI}, []string{doURI}},
+		{"AO update fails", failPosts("archival_objects"), "", "500", nil, []string{aoURI, doURI}},
+		{"extent type not in the enumeration", nil, "files", "not in ArchivesSpace's extent_extent_type enumeration", nil, []string{aoURI, doURI}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectLoc, opts := newStubProject(t, tt.wrap)
+			writeStubWorkOrder(t, projectLoc, "ER_1")
+
+			if tt.filesType != "" {
+				configLoc := filepath.Join(projectLoc, "config.yml")
+				b, err := os.ReadFile(configLoc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(configLoc, []byte(strings.Replace(string(b), "digital_files", tt.filesType, 1)), 0664); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			aipLoc := filepath.Join(projectLoc, "aips", "stub_ER_1-11111111-1111-1111-1111-111111111111")
+			erLoc := filepath.Join(aipLoc, "data", "objects", "ER_1")
+			if err := os.MkdirAll(erLoc, 0775); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(erLoc, "file.txt"), []byte("content\n"), 0664); err != nil {
+				t.Fatal(err)
+			}
+
+			aipFileLoc := filepath.Join(projectLoc, "logs", "stub-aip-file.txt")
+			if err := os.WriteFile(aipFileLoc, []byte(aipLoc+"\n"), 0664); err != nil {
+				t.Fatal(err)
+			}
+
+			err := AspaceUpdate(opts, AspaceUpdateOptions{URIPattern: "https://rstar.example.org/{component-id}"})
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+
+			changeLog, err := os.ReadFile(filepath.Join(projectLoc, "logs", "stub-aspace-update.tsv"))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.wantLogged {
+				if !strings.Contains(string(changeLog), want) {
+					t.Errorf("change log does not record %q:\n%s", want, changeLog)
+				}
+			}
+
+			for _, notWant := range tt.wantNotLogged {
+				if strings.Contains(string(changeLog), notWant) {
+					t.Errorf("change log records %q, which was not applied:\n%s", notWant, changeLog)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatExtentSize(t *testing.T) {
+	tests := []struct {
+		size     int64
+		sizeType string
+		want     string
+	}{
+		{1234, "bytes", "1234"},
+		{1234, "kilobytes", "1.23"},
+		{2500000, "megabytes", "2.50"},
+		{1500000000, "gigabytes", "1.50"},
+		{5000000000000, "terabytes", "5.00"},
+	}
+
+	for _, tt := range tests {
+		if got := formatExtentSize(tt.size, tt.sizeType); got != tt.want {
+			t.Errorf("formatExtentSize(%d, %q) = %q, want %q", tt.size, tt.sizeType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nyudlts/go-aspace"
+)
+
+// computedTag calculates the value of a bag-info.txt tag for a bag being prepped
+type computedTag func(bag preppedBag) (string, error)
+
+// preppedBag is a staged AIP along with the location of its work order in the payload
+type preppedBag struct {
+	Location     string
+	WorkOrderLoc string
+}
+
+// computedTags are the tags that can be listed under computed-tags in the bag-info-profile section of config.yml
+var computedTags = map[string]computedTag{
+	"Bagging-Date":        getBaggingDate,
+	"Payload-Oxum":        getPayloadOxum,
+	"Bag-Size":            getBagSize,
+	"nyu-dl-aip-uuid":     getAIPUUID,
+	"nyu-dl-sip-uuid":     getSIPUUID,
+	"nyu-dl-erwt-version": func(bag preppedBag) (string, error) { return VERSION, nil },
+	"nyu-dl-operator":     getOperator,
+	"nyu-dl-component-id": getWorkOrderComponentID,
+}
+
+var metsMatcher = regexp.MustCompile(`^METS\.([0-9a-f-]{36})\.xml$`)
+
+// getBagInfoProfile checks the bag-info-profile section of config.yml, returning the BagIt profile to check
+// bag-info.txt against, if one is configured
+func getBagInfoProfile() (*BagItProfile, error) {
+	unknown := []string{}
+	for _, tag := range config.BagInfoProfile.ComputedTags {
+		if _, found := computedTags[tag]; !found {
+			unknown = append(unknown, tag)
+		}
+	}
+
+	if len(unknown) > 0 {
+		known := []string{}
+		for tag := range computedTags {
+			known = append(known, tag)
+		}
+		sort.Strings(known)
+		return nil, fmt.Errorf("unknown computed tags %s in config.yml, available tags are %s", strings.Join(unknown, ", "), strings.Join(known, ", "))
+	}
+
+	if config.BagInfoProfile.BagItProfile == "" {
+		return nil, nil
+	}
+
+	profile, err := loadBagItProfile(config.BagInfoProfile.BagItProfile)
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// getComputedTags calculates each of the configured computed tags for a bag
+func getComputedTags(bag preppedBag) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, tag := range config.BagInfoProfile.ComputedTags {
+		value, err := computedTags[tag](bag)
+		if err != nil {
+			return nil, fmt.Errorf("could not compute %s: %w", tag, err)
+		}
+		tags[tag] = value
+	}
+	return tags, nil
+}
+
+func getBaggingDate(bag preppedBag) (string, error) {
+	return time.Now().Format("2006-01-02"), nil
+}
+
+func getPayloadOxum(bag preppedBag) (string, error) {
+	numFiles, size, err := getDirectorySize(filepath.Join(bag.Location, "data"))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d", size, numFiles), nil
+}
+
+func getBagSize(bag preppedBag) (string, error) {
+	_, size, err := getDirectorySize(bag.Location)
+	if err != nil {
+		return "", err
+	}
+	return humanReadableSize(size), nil
+}
+
+func getAIPUUID(bag preppedBag) (string, error) {
+	_, aipUUID, err := parseAIPName(filepath.Base(bag.Location))
+	return aipUUID, err
+}
+
+// getSIPUUID reads the SIP UUID from the name of the METS file Archivematica writes to the payload, `METS.<sip-uuid>.xml`
+func getSIPUUID(bag preppedBag) (string, error) {
+	sipUUID := ""
+	err := filepath.WalkDir(filepath.Join(bag.Location, "data"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if matches := metsMatcher.FindStringSubmatch(d.Name()); matches != nil {
+			sipUUID = matches[1]
+			return filepath.SkipAll
+		}
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if sipUUID == "" {
+		return "", fmt.Errorf("no METS file found in payload")
+	}
+	return sipUUID, nil
+}
+
+func getOperator(bag preppedBag) (string, error) {
+	operator, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return operator.Username, nil
+}
+
+// getWorkOrderComponentID reads the component id from the bag's work order, which holds a single row for the ER
+func getWorkOrderComponentID(bag preppedBag) (string, error) {
+	workOrderFile, err := os.Open(bag.WorkOrderLoc)
+	if err != nil {
+		return "", err
+	}
+	defer workOrderFile.Close()
+
+	workOrder := aspace.WorkOrder{}
+	if err := workOrder.Load(workOrderFile); err != nil {
+		return "", err
+	}
+
+	if len(workOrder.Rows) != 1 {
+		return "", fmt.Errorf("work order has %d rows, expected 1", len(workOrder.Rows))
+	}
+	return workOrder.Rows[0].GetComponentID(), nil
+}
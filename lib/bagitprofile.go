@@ -0,0 +1,273 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// BagItProfile is the part of a BagIt Profile, https://bagit-profiles.github.io/bagit-profiles-specification/,
+// that erwt checks bags against
+type BagItProfile struct {
+	Info                 map[string]string         `json:"BagIt-Profile-Info"`
+	BagInfo              map[string]BagInfoTagRule `json:"Bag-Info"`
+	ManifestsRequired    []string                  `json:"Manifests-Required"`
+	ManifestsAllowed     []string                  `json:"Manifests-Allowed"`
+	TagManifestsRequired []string                  `json:"Tag-Manifests-Required"`
+	TagManifestsAllowed  []string                  `json:"Tag-Manifests-Allowed"`
+	TagFilesRequired     []string                  `json:"Tag-Files-Required"`
+	TagFilesAllowed      []string                  `json:"Tag-Files-Allowed"`
+	AllowFetch           *bool                     `json:"Allow-Fetch.txt"`
+	Serialization        string                    `json:"Serialization"`
+	AcceptSerialization  []string                  `json:"Accept-Serialization"`
+	AcceptBagItVersion   []string                  `json:"Accept-BagIt-Version"`
+}
+
+// BagInfoTagRule constrains a single bag-info.txt tag
+type BagInfoTagRule struct {
+	Required   bool     `json:"required"`
+	Values     []string `json:"values"`
+	Repeatable *bool    `json:"repeatable"`
+}
+
+var (
+	manifestFileMatcher    = regexp.MustCompile(`^manifest-(\w+)\.txt$`)
+	tagManifestFileMatcher = regexp.MustCompile(`^tagmanifest-(\w+)\.txt$`)
+)
+
+// serializationTypes maps the extensions of serialized bags to the MIME types used in Accept-Serialization
+var serializationTypes = map[string]string{
+	".7z":     "application/x-7z-compressed",
+	".tar.gz": "application/gzip",
+	".tgz":    "application/gzip",
+	".tar":    "application/x-tar",
+	".zip":    "application/zip",
+}
+
+func loadBagItProfile(profileLoc string) (BagItProfile, error) {
+	profile := BagItProfile{}
+	b, err := os.ReadFile(profileLoc)
+	if err != nil {
+		return profile, err
+	}
+
+	if err := json.Unmarshal(b, &profile); err != nil {
+		return profile, fmt.Errorf("could not parse bagit profile %s: %w", profileLoc, err)
+	}
+
+	return profile, nil
+}
+
+// checkBagInfo lists the ways a bag's bag-info.txt tags fail the profile's Bag-Info rules
+func (p BagItProfile) checkBagInfo(tags map[string][]string) []string {
+	problems := []string{}
+	for tag, rule := range p.BagInfo {
+		values := tags[tag]
+		if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+			if rule.Required {
+				problems = append(problems, fmt.Sprintf("required tag %s is missing", tag))
+			}
+			continue
+		}
+
+		if rule.Repeatable != nil && !*rule.Repeatable && len(values) > 1 {
+			problems = append(problems, fmt.Sprintf("tag %s is not repeatable but appears %d times", tag, len(values)))
+		}
+
+		for _, value := range values {
+			if len(rule.Values) > 0 && !slices.Contains(rule.Values, value) {
+				problems = append(problems, fmt.Sprintf("tag %s has value %q, expected one of %q", tag, value, rule.Values))
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// checkSerialization checks a serialized bag, such as a 7z AIP, against the profile's serialization rules
+func (p BagItProfile) checkSerialization(bagLocation string) []string {
+	mimeType := ""
+	for ext, t := range serializationTypes {
+		if strings.HasSuffix(bagLocation, ext) {
+			mimeType = t
+		}
+	}
+
+	switch {
+	case p.Serialization == "forbidden":
+		return []string{"serialized bags are forbidden"}
+	case len(p.AcceptSerialization) > 0 && !slices.Contains(p.AcceptSerialization, mimeType):
+		return []string{fmt.Sprintf("serialization %q is not accepted, expected one of %q", mimeType, p.AcceptSerialization)}
+	}
+	return []string{}
+}
+
+// checkBag lists the ways an unserialized bag fails the profile
+func (p BagItProfile) checkBag(bagLocation string) ([]string, error) {
+	problems := []string{}
+	if p.Serialization == "required" {
+		problems = append(problems, "bag must be serialized")
+	}
+
+	//check the bagit version
+	bagitTags, err := parseTagFile(filepath.Join(bagLocation, "bagit.txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.AcceptBagItVersion) > 0 {
+		versions := bagitTags["BagIt-Version"]
+		if len(versions) != 1 || !slices.Contains(p.AcceptBagItVersion, versions[0]) {
+			problems = append(problems, fmt.Sprintf("BagIt-Version %q is not accepted, expected one of %q", strings.Join(versions, ", "), p.AcceptBagItVersion))
+		}
+	}
+
+	//check bag-info.txt
+	bagInfoTags, err := parseTagFile(filepath.Join(bagLocation, "bag-info.txt"))
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, p.checkBagInfo(bagInfoTags)...)
+
+	//check the manifests and tag files
+	entries, err := os.ReadDir(bagLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, tagManifests := []string{}, []string{}
+	for _, entry := range entries {
+		if matches := manifestFileMatcher.FindStringSubmatch(entry.Name()); matches != nil {
+			manifests = append(manifests, matches[1])
+		}
+		if matches := tagManifestFileMatcher.FindStringSubmatch(entry.Name()); matches != nil {
+			tagManifests = append(tagManifests, matches[1])
+		}
+		if entry.Name() == "fetch.txt" && p.AllowFetch != nil && !*p.AllowFetch {
+			problems = append(problems, "fetch.txt is not allowed")
+		}
+	}
+
+	problems = append(problems, checkAlgorithms("manifest", manifests, p.ManifestsRequired, p.ManifestsAllowed)...)
+	problems = append(problems, checkAlgorithms("tag manifest", tagManifests, p.TagManifestsRequired, p.TagManifestsAllowed)...)
+
+	tagFiles, err := getTagFiles(bagLocation)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, checkTagFiles(tagFiles, p.TagFilesRequired, p.TagFilesAllowed)...)
+
+	return problems, nil
+}
+
+func checkAlgorithms(kind string, found []string, required []string, allowed []string) []string {
+	problems := []string{}
+	for _, algorithm := range required {
+		if !slices.Contains(found, algorithm) {
+			problems = append(problems, fmt.Sprintf("required %s for %s is missing", kind, algorithm))
+		}
+	}
+
+	if len(allowed) > 0 {
+		for _, algorithm := range found {
+			if !slices.Contains(allowed, algorithm) {
+				problems = append(problems, fmt.Sprintf("%s for %s is not allowed", kind, algorithm))
+			}
+		}
+	}
+	return problems
+}
+
+func checkTagFiles(tagFiles []string, required []string, allowed []string) []string {
+	problems := []string{}
+	for _, pattern := range required {
+		if !slices.ContainsFunc(tagFiles, func(tagFile string) bool { return matchTagFile(pattern, tagFile) }) {
+			problems = append(problems, fmt.Sprintf("required tag file %s is missing", pattern))
+		}
+	}
+
+	if len(allowed) > 0 {
+		for _, tagFile := range tagFiles {
+			if !slices.ContainsFunc(allowed, func(pattern string) bool { return matchTagFile(pattern, tagFile) }) {
+				problems = append(problems, fmt.Sprintf("tag file %s is not allowed", tagFile))
+			}
+		}
+	}
+	return problems
+}
+
+func matchTagFile(pattern string, tagFile string) bool {
+	matched, err := path.Match(pattern, tagFile)
+	return err == nil && matched
+}
+
+// getTagFiles lists the files outside the payload, other than bagit.txt and the manifests, relative to the bag's root
+func getTagFiles(bagLocation string) ([]string, error) {
+	tagFiles := []string{}
+	err := filepath.WalkDir(bagLocation, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(bagLocation, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case d.IsDir() && rel == "data":
+			return filepath.SkipDir
+		case d.IsDir():
+			return nil
+		case rel == "bagit.txt", manifestFileMatcher.MatchString(rel), tagManifestFileMatcher.MatchString(rel):
+			return nil
+		}
+
+		tagFiles = append(tagFiles, rel)
+		return nil
+	})
+
+	return tagFiles, err
+}
+
+// parseTagFile reads a tag file such as bag-info.txt, keeping repeated tags and joining continuation lines
+func parseTagFile(tagFileLoc string) (map[string][]string, error) {
+	tagFile, err := os.Open(tagFileLoc)
+	if err != nil {
+		return nil, err
+	}
+	defer tagFile.Close()
+
+	tags := map[string][]string{}
+	lastTag := ""
+	scanner := bufio.NewScanner(tagFile)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.TrimSpace(line) == "":
+			continue
+		case (line[0] == ' ' || line[0] == '\t') && lastTag != "":
+			values := tags[lastTag]
+			values[len(values)-1] += " " + strings.TrimSpace(line)
+		default:
+			name, value, found := strings.Cut(line, ":")
+			if !found {
+				return nil, fmt.Errorf("malformed line in %s: %q", tagFileLoc, line)
+			}
+			lastTag = strings.TrimSpace(name)
+			tags[lastTag] = append(tags[lastTag], strings.TrimSpace(value))
+		}
+	}
+
+	return tags, scanner.Err()
+}
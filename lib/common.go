@@ -2,12 +2,14 @@ package lib
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/nyudlts/go-aspace"
-	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -15,32 +17,62 @@ var (
 	workOrderLocation string
 )
 
+// transfer-info.txt field patterns
+var (
+	aspaceResourceURLPtn     = regexp.MustCompile(`^/repositories/[2|3|6|99]/resources/\d*$`)
+	partnerPtn               = regexp.MustCompile(`^[tamwag|fales|nyuarchives|dlts]`)
+	contentClassificationPtn = regexp.MustCompile(`[open|closed|restricted]`)
+	packageFormatPtn         = regexp.MustCompile(`["1.0.0"|"1.0.1"]`)
+	contentTypePtn           = regexp.MustCompile(`electronic_records|electronic_records-do-not-create-DOs`)
+	transferTypePtn          = regexp.MustCompile(`[AIP|XIP]`)
+	useStatementPtn          = regexp.MustCompile(`electronic-records-reading-room`)
+)
+
 const VERSION = "v1.1.0"
 
-func loadConfig() error {
-	//read the adoc-config
-	b, err := os.ReadFile("config.yml")
+func findWorkOrder() error {
+	var err error
+	workOrderLocation, err = currentProject().WorkOrderLoc()
+	return err
+}
+
+// findAIPFile returns the one aip-file.txt in the log location, the error wraps fs.ErrNotExist when there is none
+func findAIPFile() (string, error) {
+	logFiles, err := os.ReadDir(config.LogLoc)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	//unmarshal to config options
-	if err := yaml.Unmarshal(b, &config); err != nil {
-		return err
+	matches := []string{}
+	for _, logFile := range logFiles {
+		if strings.Contains(logFile.Name(), "aip-file.txt") {
+			matches = append(matches, logFile.Name())
+		}
 	}
 
-	return nil
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("aip-file.txt not found in %s: %w", config.LogLoc, fs.ErrNotExist)
+	case 1:
+		return filepath.Join(config.LogLoc, matches[0]), nil
+	default:
+		return "", fmt.Errorf("more than one aip-file.txt in %s: %s", config.LogLoc, strings.Join(matches, ", "))
+	}
 }
 
-func findWorkOrder() error {
-	mdDir := filepath.Join(config.SIPLoc, "metadata")
-	var err error
-	workOrderFilename, err := getWorkOrderFile(mdDir)
-	if err != nil {
-		return err
+// parseAIPName splits an AIP directory name, `<collection-code>_<component-id>-<aip-uuid>`, into its component id and uuid
+func parseAIPName(name string) (string, string, error) {
+	if len(name) < 38 || name[len(name)-37] != '-' {
+		return "", "", fmt.Errorf("%s is not a valid AIP name", name)
 	}
-	workOrderLocation = filepath.Join(mdDir, workOrderFilename)
-	return nil
+
+	aipUUID := name[len(name)-36:]
+	if _, err := uuid.Parse(aipUUID); err != nil {
+		return "", "", fmt.Errorf("%s is not a valid AIP name: %w", name, err)
+	}
+
+	componentID := strings.TrimPrefix(name[:len(name)-37], config.CollectionCode+"_")
+	return componentID, aipUUID, nil
 }
 
 func getWorkOrderFile(path string) (string, error) {
@@ -63,7 +95,7 @@ func parseWorkOrder(mdDir string, workorderName string) (aspace.WorkOrder, error
 
 	wof, err := os.Open(workOrderLoc)
 	if err != nil {
-		panic(err)
+		return aspace.WorkOrder{}, err
 	}
 	defer wof.Close()
 	var workOrder aspace.WorkOrder
@@ -75,15 +107,37 @@ func parseWorkOrder(mdDir string, workorderName string) (aspace.WorkOrder, error
 
 // model definitions
 type Config struct {
-	SIPLoc           string `yaml:"sip-location"`
-	SourceLoc        string `yaml:"source-location"`
-	PartnerCode      string `yaml:"partner-code"`
-	CollectionCode   string `yaml:"collection-code"`
-	ProjectLoc       string `yaml:"project-location"`
-	LogLoc           string `yaml:"log-location"`
-	AIPLoc           string `yaml:"aip-location"`
-	AMTransferSource string `yaml:"archivematica-transfer-source"`
-	XferLoc          string `yaml:"xfer-location"`
+	SIPLoc           string         `yaml:"sip-location"`
+	SourceLoc        string         `yaml:"source-location"`
+	PartnerCode      string         `yaml:"partner-code"`
+	CollectionCode   string         `yaml:"collection-code"`
+	ProjectLoc       string         `yaml:"project-location"`
+	LogLoc           string         `yaml:"log-location"`
+	AIPLoc           string         `yaml:"aip-location"`
+	AMTransferSource string         `yaml:"archivematica-transfer-source"`
+	XferLoc          string         `yaml:"xfer-location"`
+	AspaceConfigLoc  string         `yaml:"aspace-config"`
+	AspaceEnv        string         `yaml:"aspace-environment"`
+	AspaceStaffURL   string         `yaml:"aspace-staff-url"`
+	AspacePublicURL  string         `yaml:"aspace-public-url"`
+	FilesExtentType  string         `yaml:"aspace-files-extent-type"`
+	SizeExtentType   string         `yaml:"aspace-size-extent-type"`
+	RstarURIPattern  string         `yaml:"rstar-uri-pattern"`
+	RstarHost        string         `yaml:"rstar-host"`
+	RstarUser        string         `yaml:"rstar-user"`
+	RstarLoc         string         `yaml:"rstar-location"`
+	RstarSSHKey      string         `yaml:"rstar-ssh-key"`
+	RstarKnownHosts  string         `yaml:"rstar-known-hosts"`
+	DeliveryBackend  string         `yaml:"delivery-backend"`
+	ArchiveLoc       string         `yaml:"archive-location"`
+	AmaticaConfigLoc string         `yaml:"archivematica-config"`
+	BagInfoProfile   BagInfoProfile `yaml:"bag-info-profile"`
+}
+
+// BagInfoProfile configures the tags `aip prep` adds to bag-info.txt and the BagIt profile the result must meet
+type BagInfoProfile struct {
+	ComputedTags []string `yaml:"computed-tags"`
+	BagItProfile string   `yaml:"bagit-profile"`
 }
 
 type TransferInfo struct {
@@ -110,6 +164,100 @@ func (t *TransferInfo) GetResourceID() string {
 	return split[len(split)-1]
 }
 
+func (ti TransferInfo) Validate() error {
+	//ensure contact-name is not blank
+	if ti.ContactName == "" {
+		return fmt.Errorf("field `Contact-Name` is blank in transfer-info.txt")
+	}
+
+	//ensure contact-email is not blank
+	if ti.ContactEmail == "" {
+		return fmt.Errorf("`Contact-Email` is blank in transfer-info.txt")
+	}
+
+	//ensure contact-phone is not blank
+	if ti.ContactPhone == "" {
+		return fmt.Errorf("`Contact-Phone` is blank in transfer-info.txt")
+	}
+
+	//ensure that Internal Sender Identifier is valid
+	split := strings.Split(ti.InternalSenderIdentifier, "/")
+	if len(split) != 2 {
+		return fmt.Errorf("`Internal-Sender-Identifier` is malformed in transfer-info.txt, must contains a single `/`")
+	}
+
+	if !partnerPtn.MatchString(split[0]) {
+		return fmt.Errorf("`Internal-Sender-Identifier` is malformed in transfer-info.txt, partner code must be one of: `fales`, `tamwag`, or `nyuarchive`")
+	}
+
+	//Ensure Source Organization is not blank
+	if ti.OrganizationAddress == "" {
+		return fmt.Errorf("`Organization-Address` is blank in transfer-info.txt")
+	}
+
+	//Ensure Source Organization is not blank
+	if ti.SourceOrganization == "" {
+		return fmt.Errorf("`Source-Organization` is blank in transfer-info.txt")
+	}
+
+	//Ensure there is A ArchivesSpace Resource URL is present and valid
+	if !aspaceResourceURLPtn.MatchString(ti.ArchivesSpaceResourceURL) {
+		return fmt.Errorf("`nyu-dl-archivesspace-resource-url` malformed in transfer-info.txt, must be in the form `/repositories/X/resources/Y`")
+	}
+
+	//Ensure Resource-ID is not blank
+	if ti.ResourceID == "" {
+		return fmt.Errorf("`nyu-dl-resource-id` is blank in transfer-info.txt")
+	}
+
+	//Ensure Resource-Title is not blank
+	if ti.ResourceTitle == "" {
+		return fmt.Errorf("`nyu-dl-resource-title` is blank in transfer-info.txt")
+	}
+
+	//ensure the Content-Type is valid
+	if !contentTypePtn.MatchString(ti.ContentType) {
+		return fmt.Errorf("`nyu-dl-content-type` must have a value of `electronic_records`, or `electronic_records-do-not-create-DOs`, values was %s", ti.ContentType)
+	}
+
+	//ensure the Content-Classification is valid
+	if !contentClassificationPtn.MatchString(ti.ContentClassification) {
+		return fmt.Errorf("`nyu-dl-content-classification` must have a value of `open`, `closed`, or `restricted`")
+	}
+
+	//ensure that the project name is valid
+	split = strings.Split(ti.ProjectName, "/")
+	if len(split) != 2 {
+		return fmt.Errorf("`nyu-dl-project-name` is malformed in transfer-info.txt, must contains a single `/`")
+	}
+
+	if !partnerPtn.MatchString(split[0]) {
+		return fmt.Errorf("`nyu-dl-project-name` is malformed in transfer-info.txt, partner code must be one of: `fales`, `tamwag`, or `nyuarchive`")
+	}
+
+	//ensure rstar uuid is present and valid
+	if _, err := uuid.Parse(ti.RStarCollectionID); err != nil {
+		return err
+	}
+
+	//ensure the package-format is valid
+	if !packageFormatPtn.MatchString(ti.PackageFormat) {
+		return fmt.Errorf("`nyu-dl-package-format` is malformed in transfer-info.txt, partner code must be one of: `1.0.0`, or 	`1.0.1`")
+	}
+
+	//ensure the use-statement is valid
+	if !useStatementPtn.MatchString(ti.UseStatement) {
+		return fmt.Errorf("`nyu-dl-use-statement` is malformed in transfer-info.txt, use statement must be `electronic-records-reading-room`")
+	}
+
+	//ensure the transfer-type is valid
+	if !transferTypePtn.MatchString(ti.TransferType) {
+		return fmt.Errorf("`nyu-dl-transfer-type` is malformed in transfer-info.txt, transfer type must be one of: `AIP`, `DIP`, or `SIP`")
+	}
+
+	return nil
+}
+
 type Params struct {
 	PartnerCode  string
 	ResourceCode string
@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindAIPFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        []string
+		want         string
+		wantNotExist bool
+		wantErr      string
+	}{
+		{"one aip-file", []string{"cc-aip-file.txt", "cc-xip-prep.tsv"}, "cc-aip-file.txt", false, ""},
+		{"no aip-file", []string{"cc-xip-prep.tsv"}, "", true, "not found"},
+		{"more than one aip-file", []string{"cc-aip-file.txt", "old-aip-file.txt"}, "", false, "more than one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := config
+			t.Cleanup(func() { config = previous })
+			config = Config{LogLoc: t.TempDir()}
+
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(config.LogLoc, name), []byte{}, 0664); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := findAIPFile()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != filepath.Join(config.LogLoc, tt.want) {
+					t.Errorf("got %s, want %s", got, tt.want)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+
+			//reconcile only treats a missing aip-file as not yet ingested
+			if errors.Is(err, fs.ErrNotExist) != tt.wantNotExist {
+				t.Errorf("got errors.Is(err, fs.ErrNotExist) %v, want %v", !tt.wantNotExist, tt.wantNotExist)
+			}
+		})
+	}
+}
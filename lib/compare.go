@@ -0,0 +1,282 @@
+package lib
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// stages of the workflow compared by `project compare`, in order
+var compareStages = []string{"source", "sip", "xfer", "aip"}
+
+// normalizedMatcher matches the preservation and access copies archivematica adds next to the originals
+var normalizedMatcher = regexp.MustCompile(`-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\.\w+$`)
+
+// stageCount is the payload of an ER at one stage of the workflow
+type stageCount struct {
+	Present  bool
+	NumFiles int
+	Size     int64
+	Errors   int
+}
+
+type erComparison struct {
+	ERID    string
+	Stages  map[string]stageCount
+	Flagged bool
+	Detail  string
+}
+
+func CompareProject() error {
+	fmt.Printf("ewt project compare, %s\n", VERSION)
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	comparisons := map[string]*erComparison{}
+	getComparison := func(erID string) *erComparison {
+		if _, found := comparisons[erID]; !found {
+			comparisons[erID] = &erComparison{ERID: erID, Stages: map[string]stageCount{}}
+		}
+		return comparisons[erID]
+	}
+
+	//source and sip hold ER directories alongside a metadata directory
+	for stage, loc := range map[string]string{"source": config.SourceLoc, "sip": config.SIPLoc} {
+		entries, err := readStageDir(loc)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && entry.Name() != "metadata" {
+				getComparison(entry.Name()).Stages[stage] = countPayload(filepath.Join(loc, entry.Name()), nil)
+			}
+		}
+	}
+
+	//xfer packages hold the ER's payload under `<collection-code>_<er-id>/<er-id>`
+	entries, err := readStageDir(config.XferLoc)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if erID, found := strings.CutPrefix(entry.Name(), config.CollectionCode+"_"); found && entry.IsDir() {
+			getComparison(erID).Stages["xfer"] = countPayload(filepath.Join(config.XferLoc, entry.Name(), erID), nil)
+		}
+	}
+
+	//aips hold the ER's payload in data/objects, along with the metadata and normalized copies archivematica adds
+	entries, err = readStageDir(config.AIPLoc)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		erID, _, err := parseAIPName(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		getComparison(erID).Stages["aip"] = countPayload(filepath.Join(config.AIPLoc, entry.Name(), "data", "objects"), isAmaticaAddition)
+	}
+
+	//a stage that no ER has reached yet is not expected to hold any of them
+	populated := map[string]bool{}
+	for _, comparison := range comparisons {
+		for stage, count := range comparison.Stages {
+			populated[stage] = populated[stage] || count.Present
+		}
+	}
+
+	erIDs := []string{}
+	numFlagged := 0
+	for erID, comparison := range comparisons {
+		erIDs = append(erIDs, erID)
+		comparison.compare(populated)
+		if comparison.Flagged {
+			numFlagged++
+		}
+	}
+	sort.Strings(erIDs)
+
+	printComparisonTable(erIDs, comparisons)
+
+	reportLoc := currentProject().LogLoc("compare.tsv")
+	if err := writeComparisonReport(reportLoc, erIDs, comparisons); err != nil {
+		return err
+	}
+	fmt.Printf("  * report written to %s\n", reportLoc)
+
+	if numFlagged > 0 {
+		return fmt.Errorf("%d of %d ERs changed between stages", numFlagged, len(erIDs))
+	}
+
+	return nil
+}
+
+func readStageDir(loc string) ([]os.DirEntry, error) {
+	if loc == "" {
+		return []os.DirEntry{}, nil
+	}
+
+	entries, err := os.ReadDir(loc)
+	if os.IsNotExist(err) {
+		return []os.DirEntry{}, nil
+	}
+	return entries, err
+}
+
+// isAmaticaAddition reports whether a path in an AIP's data/objects was added by archivematica rather than transferred
+func isAmaticaAddition(rel string, d fs.DirEntry) bool {
+	top := strings.Split(rel, "/")[0]
+	return top == "metadata" || top == "submissionDocumentation" || (!d.IsDir() && normalizedMatcher.MatchString(d.Name()))
+}
+
+// countPayload counts the files and bytes under root, skipping anything exclude matches and counting unreadable entries
+func countPayload(root string, exclude func(rel string, d fs.DirEntry) bool) stageCount {
+	count := stageCount{}
+	if _, err := os.Stat(root); err != nil {
+		return count
+	}
+	count.Present = true
+
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			count.Errors++
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, p)
+		if rel == "." {
+			return nil
+		}
+
+		if exclude != nil && exclude(filepath.ToSlash(rel), d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			count.Errors++
+			return nil
+		}
+		count.NumFiles++
+		count.Size += info.Size()
+		return nil
+	})
+
+	return count
+}
+
+// compare flags an ER whose file count or size differs between consecutive stages it is present in, or that is
+// missing from a later stage holding other ERs; an ER is only expected to be missing from the sip once its payload has
+// been moved to xfer
+func (c *erComparison) compare(populated map[string]bool) {
+	problems := []string{}
+	previous := ""
+	for _, stage := range compareStages {
+		count := c.Stages[stage]
+		if !count.Present {
+			movedToXfer := stage == "sip" && c.Stages["xfer"].Present
+			if previous != "" && populated[stage] && !movedToXfer {
+				problems = append(problems, fmt.Sprintf("missing from %s", stage))
+			}
+			continue
+		}
+
+		if count.Errors > 0 {
+			problems = append(problems, fmt.Sprintf("%d unreadable entries in %s", count.Errors, stage))
+		}
+
+		if previous != "" {
+			before := c.Stages[previous]
+			switch {
+			case count.NumFiles < before.NumFiles:
+				problems = append(problems, fmt.Sprintf("%d files lost between %s and %s", before.NumFiles-count.NumFiles, previous, stage))
+			case count.NumFiles > before.NumFiles:
+				problems = append(problems, fmt.Sprintf("%d files added between %s and %s", count.NumFiles-before.NumFiles, previous, stage))
+			case count.Size != before.Size:
+				problems = append(problems, fmt.Sprintf("size changed by %d bytes between %s and %s", count.Size-before.Size, previous, stage))
+			}
+		}
+		previous = stage
+	}
+
+	c.Flagged = len(problems) > 0
+	c.Detail = strings.Join(problems, "; ")
+}
+
+func printComparisonTable(erIDs []string, comparisons map[string]*erComparison) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ER\tSOURCE\tSIP\tXFER\tAIP\tSTATUS")
+	for _, erID := range erIDs {
+		comparison := comparisons[erID]
+		row := []string{erID}
+		for _, stage := range compareStages {
+			count := comparison.Stages[stage]
+			if !count.Present {
+				row = append(row, "-")
+				continue
+			}
+			row = append(row, fmt.Sprintf("%d files, %s", count.NumFiles, humanReadableSize(count.Size)))
+		}
+
+		status := "OK"
+		if comparison.Flagged {
+			status = "CHANGED: " + comparison.Detail
+		}
+		fmt.Fprintln(table, strings.Join(append(row, status), "\t"))
+	}
+	table.Flush()
+}
+
+func writeComparisonReport(reportLoc string, erIDs []string, comparisons map[string]*erComparison) error {
+	reportFile, err := os.Create(reportLoc)
+	if err != nil {
+		return err
+	}
+	defer reportFile.Close()
+
+	writer := csv.NewWriter(reportFile)
+	writer.Comma = '\t'
+	header := []string{"er"}
+	for _, stage := range compareStages {
+		header = append(header, stage+"_files", stage+"_bytes")
+	}
+	writer.Write(append(header, "status", "detail"))
+
+	for _, erID := range erIDs {
+		comparison := comparisons[erID]
+		row := []string{erID}
+		for _, stage := range compareStages {
+			count := comparison.Stages[stage]
+			if !count.Present {
+				row = append(row, "", "")
+				continue
+			}
+			row = append(row, strconv.Itoa(count.NumFiles), strconv.FormatInt(count.Size, 10))
+		}
+
+		status := "OK"
+		if comparison.Flagged {
+			status = "CHANGED"
+		}
+		writer.Write(append(row, status, comparison.Detail))
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCompareFiles writes files of the given sizes under dir, named by their index
+func writeCompareFiles(t *testing.T, dir string, sizes ...int) {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, size := range sizes {
+		if err := os.WriteFile(filepath.Join(dir, "file-"+string(rune('a'+i))+".txt"), []byte(strings.Repeat("x", size)), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompareProject(t *testing.T) {
+	//keep the site and user configs on the host out of the test
+	previousSiteConfigLoc := siteConfigLoc
+	t.Cleanup(func() { siteConfigLoc = previousSiteConfigLoc })
+	siteConfigLoc = ""
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("ERWT_PROJECT", "")
+
+	previous := config
+	t.Cleanup(func() { config = previous })
+
+	projectLoc := t.TempDir()
+	sourceLoc := t.TempDir()
+	projectConfig := "collection-code: cc\nsource-location: " + sourceLoc + "\n"
+	if err := os.WriteFile(filepath.Join(projectLoc, "config.yml"), []byte(projectConfig), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{"logs", "sip", "xfer", "aips"} {
+		if err := os.MkdirAll(filepath.Join(projectLoc, dir), 0775); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aipDir := func(erID string) string {
+		return filepath.Join(projectLoc, "aips", "cc_"+erID+"-00000000-0000-0000-0000-000000000000", "data", "objects")
+	}
+
+	//moved from the sip to xfer, with the metadata and normalized copies archivematica adds in the aip
+	writeCompareFiles(t, filepath.Join(sourceLoc, "ER_1"), 10, 20)
+	writeCompareFiles(t, filepath.Join(projectLoc, "xfer", "cc_ER_1", "ER_1"), 10, 20)
+	writeCompareFiles(t, aipDir("ER_1"), 10, 20)
+	writeCompareFiles(t, filepath.Join(aipDir("ER_1"), "metadata", "transfers"), 5)
+	writeCompareFiles(t, filepath.Join(aipDir("ER_1"), "submissionDocumentation"), 5)
+	if err := os.WriteFile(filepath.Join(aipDir("ER_1"), "file-a-c5ac2d4f-7a8d-4f1c-9c9e-0a1b2c3d4e5f.tif"), []byte("normalized"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	//a file lost between source and xfer
+	writeCompareFiles(t, filepath.Join(sourceLoc, "ER_2"), 10, 20)
+	writeCompareFiles(t, filepath.Join(projectLoc, "xfer", "cc_ER_2", "ER_2"), 10)
+	writeCompareFiles(t, aipDir("ER_2"), 10)
+
+	//a file whose size changed between xfer and the aip
+	writeCompareFiles(t, filepath.Join(sourceLoc, "ER_3"), 10)
+	writeCompareFiles(t, filepath.Join(projectLoc, "xfer", "cc_ER_3", "ER_3"), 10)
+	writeCompareFiles(t, aipDir("ER_3"), 11)
+
+	//transferred but never stored as an aip
+	writeCompareFiles(t, filepath.Join(sourceLoc, "ER_4"), 10)
+	writeCompareFiles(t, filepath.Join(projectLoc, "xfer", "cc_ER_4", "ER_4"), 10)
+
+	//still in the sip, never moved to xfer
+	writeCompareFiles(t, filepath.Join(sourceLoc, "ER_5"), 10)
+	writeCompareFiles(t, filepath.Join(projectLoc, "sip", "ER_5"), 10)
+
+	SetProject(projectLoc)
+	t.Cleanup(func() { SetProject("") })
+
+	err := CompareProject()
+	if err == nil || !strings.Contains(err.Error(), "4 of 5 ERs") {
+		t.Fatalf("got %v, want 4 of 5 ERs flagged", err)
+	}
+
+	reportFile, err := os.Open(filepath.Join(projectLoc, "logs", "cc-compare.tsv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reportFile.Close()
+
+	reader := csv.NewReader(reportFile)
+	reader.Comma = '\t'
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	details := map[string]string{}
+	for _, record := range records[1:] {
+		details[record[0]] = record[len(record)-2] + " " + record[len(record)-1]
+	}
+
+	want := map[string]string{
+		"ER_1": "OK ",
+		"ER_2": "CHANGED 1 files lost between source and xfer",
+		"ER_3": "CHANGED size changed by 1 bytes between xfer and aip",
+		"ER_4": "CHANGED missing from aip",
+		"ER_5": "CHANGED missing from xfer; missing from aip",
+	}
+
+	for erID, detail := range want {
+		if details[erID] != detail {
+			t.Errorf("%s: got %q, want %q", erID, details[erID], detail)
+		}
+	}
+}
@@ -0,0 +1,630 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nyudlts/bytemath"
+)
+
+// TransferOptions holds the settings for `aip transfer`
+type TransferOptions struct {
+	AIPLoc     string
+	NumWorkers int
+	Backend    string
+}
+
+// deliveryBackend delivers bags to R* or a staging location
+type deliveryBackend interface {
+	Name() string
+	Destination() string
+	DeliverBag(bag string, numWorkers int) bagDelivery
+	Close() error
+}
+
+type bagDelivery struct {
+	Bag        string
+	NumFiles   int
+	NumSkipped int
+	Bytes      int64
+	Duration   time.Duration
+	Err        error
+}
+
+type deliveryJob struct {
+	Bag        string
+	LocalPath  string
+	RemotePath string
+	Size       int64
+}
+
+type deliveryResult struct {
+	deliveryJob
+	Offset   int64
+	Written  int64
+	Duration time.Duration
+	Status   string
+	Err      error
+}
+
+const (
+	sftpBackendName       = "sftp"
+	filesystemBackendName = "filesystem"
+	rsyncBackendName      = "rsync"
+
+	deliveryTransferred = "TRANSFERRED"
+	deliveryResumed     = "RESUMED"
+	deliverySkipped     = "SKIPPED"
+	deliveryFailed      = "ERROR"
+)
+
+func TransferAIPs(opts TransferOptions) error {
+	fmt.Printf("ewt aip transfer, %s\n", VERSION)
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	if config.RstarLoc == "" {
+		return fmt.Errorf("`rstar-location` must be set in config.yml")
+	}
+
+	aipLoc := firstNonEmpty(opts.AIPLoc, config.AIPLoc, "aips")
+	bags, err := getBags(aipLoc)
+	if err != nil {
+		return err
+	}
+
+	if opts.NumWorkers < 1 {
+		opts.NumWorkers = 1
+	}
+
+	//connect to the delivery location
+	backend, err := getDeliveryBackend(firstNonEmpty(opts.Backend, config.DeliveryBackend, sftpBackendName))
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+	fmt.Printf("  * delivering %d bags to %s with %s\n", len(bags), backend.Destination(), backend.Name())
+
+	//deliver the bags
+	return deliverBags(backend, bags, opts.NumWorkers)
+}
+
+func getDeliveryBackend(name string) (deliveryBackend, error) {
+	switch name {
+	case sftpBackendName:
+		return dialSFTP()
+	case filesystemBackendName:
+		return newFilesystemBackend()
+	case rsyncBackendName:
+		return newRsyncBackend()
+	default:
+		return nil, fmt.Errorf("unknown delivery backend %q, must be one of: `%s`, `%s`, or `%s`", name, sftpBackendName, filesystemBackendName, rsyncBackendName)
+	}
+}
+
+// getBags returns the paths of the bag directories in a location
+func getBags(aipLoc string) ([]string, error) {
+	info, err := os.Stat(aipLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", aipLoc)
+	}
+
+	entries, err := os.ReadDir(aipLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	bags := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			bags = append(bags, filepath.Join(aipLoc, entry.Name()))
+		}
+	}
+
+	if len(bags) < 1 {
+		return nil, fmt.Errorf("%s does not contain any bags", aipLoc)
+	}
+
+	return bags, nil
+}
+
+// deliverBags delivers each bag in turn, recording the outcome of every bag in the transfer log
+func deliverBags(backend deliveryBackend, bags []string, numWorkers int) error {
+	xferLogLoc := currentProject().LogLoc("aip-transfer.tsv")
+	xferLog, err := openTransferLog(xferLogLoc)
+	if err != nil {
+		return err
+	}
+	defer xferLog.Close()
+
+	writer := csv.NewWriter(xferLog)
+	writer.Comma = '\t'
+
+	numFailed := 0
+	for _, bag := range bags {
+		delivery := backend.DeliverBag(bag, numWorkers)
+
+		status := "OK"
+		errMsg := ""
+		if delivery.Err != nil {
+			numFailed++
+			status = "FAILED"
+			errMsg = delivery.Err.Error()
+			fmt.Printf("  * %s: FAILED, %s\n", delivery.Bag, errMsg)
+		} else if delivery.Bytes == 0 {
+			fmt.Printf("  * %s: OK, already delivered\n", delivery.Bag)
+		} else {
+			fmt.Printf("  * %s: OK, %s transferred in %s\n", delivery.Bag, bytemath.ConvertBytesToHumanReadable(delivery.Bytes), delivery.Duration.Round(time.Millisecond))
+		}
+
+		writer.Write([]string{
+			time.Now().Format(time.RFC3339),
+			backend.Name(),
+			delivery.Bag,
+			backend.Destination(),
+			strconv.Itoa(delivery.NumFiles),
+			strconv.Itoa(delivery.NumSkipped),
+			strconv.FormatInt(delivery.Bytes, 10),
+			strconv.FormatInt(delivery.Duration.Milliseconds(), 10),
+			status,
+			errMsg,
+		})
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("  * transfer log written to %s\n", xferLogLoc)
+	if numFailed > 0 {
+		return fmt.Errorf("%d of %d bags failed to transfer, rerun to resume", numFailed, len(bags))
+	}
+
+	return nil
+}
+
+func openTransferLog(xferLogLoc string) (*os.File, error) {
+	xferLog, err := os.OpenFile(xferLogLoc, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0664)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := xferLog.Stat()
+	if err != nil {
+		xferLog.Close()
+		return nil, err
+	}
+
+	if info.Size() == 0 {
+		writer := csv.NewWriter(xferLog)
+		writer.Comma = '\t'
+		writer.Write([]string{"timestamp", "backend", "bag", "destination", "files", "files_skipped", "bytes_transferred", "duration_ms", "status", "error"})
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			xferLog.Close()
+			return nil, err
+		}
+	}
+
+	return xferLog, nil
+}
+
+// deliverFiles creates a bag's directories with mkdir and uploads its files with put on a pool of workers,
+// it is shared by the backends that copy file by file
+func deliverFiles(bag string, destination string, numWorkers int, mkdir func(string) error, put func(deliveryJob) deliveryResult) bagDelivery {
+	bagName := filepath.Base(bag)
+	delivery := bagDelivery{Bag: bagName}
+	start := time.Now()
+
+	//create the directories and gather the files to transfer
+	jobs := []deliveryJob{}
+	if err := filepath.Walk(bag, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(bag, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			rel = ""
+		}
+		target := joinDestination(destination, bagName, rel)
+
+		if info.IsDir() {
+			return mkdir(target)
+		}
+
+		jobs = append(jobs, deliveryJob{bagName, p, target, info.Size()})
+		return nil
+	}); err != nil {
+		delivery.Err = fmt.Errorf("could not prepare %s: %w", bagName, err)
+		return delivery
+	}
+
+	jobChan := make(chan deliveryJob)
+	resultChan := make(chan deliveryResult)
+	wg := sync.WaitGroup{}
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobChan {
+				resultChan <- put(job)
+			}
+		}()
+	}
+
+	go func() {
+		for _, job := range jobs {
+			jobChan <- job
+		}
+		close(jobChan)
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	numErrors := 0
+	count := 0
+	for result := range resultChan {
+		count++
+		if result.Err != nil {
+			numErrors++
+			fmt.Printf("  * [%d/%d] [ERROR] %s: %s\n", count, len(jobs), result.RemotePath, result.Err.Error())
+			continue
+		}
+
+		delivery.NumFiles++
+		delivery.Bytes += result.Written
+		if result.Status == deliverySkipped {
+			delivery.NumSkipped++
+			fmt.Printf("  * [%d/%d] %s %s: already delivered\n", count, len(jobs), result.Status, result.RemotePath)
+			continue
+		}
+		fmt.Printf("  * [%d/%d] %s %s: %s in %s\n", count, len(jobs), result.Status, result.RemotePath, bytemath.ConvertBytesToHumanReadable(result.Written), result.Duration.Round(time.Millisecond))
+	}
+
+	delivery.Duration = time.Since(start)
+	if numErrors > 0 {
+		delivery.Err = fmt.Errorf("%d of %d files did not transfer", numErrors, len(jobs))
+	}
+
+	return delivery
+}
+
+// joinDestination joins a bag's relative path to the destination, remote paths always use forward slashes
+func joinDestination(destination string, bagName string, rel string) string {
+	return strings.TrimSuffix(destination, "/") + "/" + bagName + "/" + filepath.ToSlash(rel)
+}
+
+// putWithResume copies a file after checking the size of any copy already at the destination, a copy of the same
+// size is skipped when its checksum matches and sent again when it does not, and a partial one is resumed from its end
+func putWithResume(job deliveryJob, destSize func(string) (int64, bool), destSum func(string) (string, error), copyFile func(deliveryJob, int64) (int64, error)) deliveryResult {
+	result := deliveryResult{deliveryJob: job, Status: deliveryFailed}
+	start := time.Now()
+
+	if size, ok := destSize(job.RemotePath); ok {
+		switch {
+		case size == job.Size && matchesDestination(job, destSum):
+			result.Offset = job.Size
+			result.Status = deliverySkipped
+			result.Duration = time.Since(start)
+			return result
+		case size == job.Size:
+			fmt.Printf("  * [WARNING] %s does not match %s, sending it again\n", job.RemotePath, job.LocalPath)
+		case size < job.Size:
+			result.Offset = size
+		}
+	}
+
+	result.Written, result.Err = copyFile(job, result.Offset)
+	result.Duration = time.Since(start)
+	if result.Err != nil {
+		return result
+	}
+
+	result.Status = deliveryTransferred
+	if result.Offset > 0 {
+		result.Status = deliveryResumed
+	}
+	return result
+}
+
+// matchesDestination reports whether the copy at the destination has the same sha256 as the local file, a copy whose
+// checksum can not be read does not match
+func matchesDestination(job deliveryJob, destSum func(string) (string, error)) bool {
+	remoteSum, err := destSum(job.RemotePath)
+	if err != nil {
+		return false
+	}
+
+	localFile, err := os.Open(job.LocalPath)
+	if err != nil {
+		return false
+	}
+	defer localFile.Close()
+
+	localSum, err := sha256Sum(localFile)
+	return err == nil && localSum == remoteSum
+}
+
+// filesystemBackend copies bags to a local or NFS mounted directory, such as a staging share
+type filesystemBackend struct {
+	destination string
+}
+
+func newFilesystemBackend() (*filesystemBackend, error) {
+	info, err := os.Stat(config.RstarLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", config.RstarLoc)
+	}
+
+	return &filesystemBackend{config.RstarLoc}, nil
+}
+
+func (f *filesystemBackend) Name() string        { return filesystemBackendName }
+func (f *filesystemBackend) Destination() string { return f.destination }
+func (f *filesystemBackend) Close() error        { return nil }
+
+func (f *filesystemBackend) DeliverBag(bag string, numWorkers int) bagDelivery {
+	//copying a bag onto itself would truncate it
+	sourceInfo, err := os.Stat(filepath.Dir(bag))
+	if err != nil {
+		return bagDelivery{Bag: filepath.Base(bag), Err: err}
+	}
+	destInfo, err := os.Stat(f.destination)
+	if err != nil {
+		return bagDelivery{Bag: filepath.Base(bag), Err: err}
+	}
+	if os.SameFile(sourceInfo, destInfo) {
+		return bagDelivery{Bag: filepath.Base(bag), Err: fmt.Errorf("%s is the aips location, not a delivery location", f.destination)}
+	}
+
+	mkdir := func(p string) error { return os.MkdirAll(filepath.FromSlash(p), 0775) }
+	return deliverFiles(bag, f.destination, numWorkers, mkdir, func(job deliveryJob) deliveryResult {
+		return putWithResume(job, f.destSize, f.destSum, f.copyFile)
+	})
+}
+
+func (f *filesystemBackend) destSize(p string) (int64, bool) {
+	info, err := os.Stat(filepath.FromSlash(p))
+	if err != nil {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+func (f *filesystemBackend) destSum(p string) (string, error) {
+	destFile, err := os.Open(filepath.FromSlash(p))
+	if err != nil {
+		return "", err
+	}
+	defer destFile.Close()
+	return sha256Sum(destFile)
+}
+
+func (f *filesystemBackend) copyFile(job deliveryJob, offset int64) (int64, error) {
+	source, err := os.Open(job.LocalPath)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	target, err := os.OpenFile(filepath.FromSlash(job.RemotePath), flags, 0664)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := source.Seek(offset, io.SeekStart); err != nil {
+		target.Close()
+		return 0, err
+	}
+
+	if _, err := target.Seek(offset, io.SeekStart); err != nil {
+		target.Close()
+		return 0, err
+	}
+
+	written, err := io.Copy(target, source)
+	if err != nil {
+		target.Close()
+		return written, err
+	}
+
+	//make sure the copy is on the share before it is reported as delivered
+	if err := target.Sync(); err != nil {
+		target.Close()
+		return written, err
+	}
+
+	if err := target.Close(); err != nil {
+		return written, err
+	}
+
+	if size, _ := f.destSize(job.RemotePath); size != job.Size {
+		return written, fmt.Errorf("size mismatch, expected %d bytes, found %d", job.Size, size)
+	}
+
+	return written, nil
+}
+
+var (
+	rsyncFilesPtn = regexp.MustCompile(`Number of regular files transferred: ([\d,]+)`)
+	rsyncBytesPtn = regexp.MustCompile(`Total transferred file size: ([\d,]+) bytes`)
+)
+
+// rsyncBackend runs rsync for each bag, over ssh when `rstar-host` is set
+type rsyncBackend struct {
+	destination string
+	sshArgs     []string
+	sshTarget   string
+}
+
+func newRsyncBackend() (*rsyncBackend, error) {
+	if _, err := exec.LookPath("rsync"); err != nil {
+		return nil, fmt.Errorf("rsync is not installed: %w", err)
+	}
+
+	if config.RstarHost == "" {
+		return &rsyncBackend{destination: config.RstarLoc}, nil
+	}
+
+	host, port, err := net.SplitHostPort(config.RstarHost)
+	if err != nil {
+		host, port = config.RstarHost, defaultSSHPort
+	}
+
+	sshTarget := host
+	if config.RstarUser != "" {
+		sshTarget = config.RstarUser + "@" + host
+	}
+
+	//host keys are always verified, never added
+	sshArgs := []string{"ssh", "-p", port, "-o", "StrictHostKeyChecking=yes", "-o", "BatchMode=yes"}
+	if config.RstarSSHKey != "" {
+		sshArgs = append(sshArgs, "-i", config.RstarSSHKey)
+	}
+	if config.RstarKnownHosts != "" {
+		sshArgs = append(sshArgs, "-o", "UserKnownHostsFile="+config.RstarKnownHosts)
+	}
+
+	return &rsyncBackend{sshTarget + ":" + config.RstarLoc, sshArgs, sshTarget}, nil
+}
+
+// sshCommand is the ssh command for rsync's -e, rsync splits it on whitespace so each argument is quoted to keep key
+// and known_hosts paths with spaces in one piece
+func (r *rsyncBackend) sshCommand() string {
+	quoted := []string{}
+	for _, arg := range r.sshArgs {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (r *rsyncBackend) Name() string        { return rsyncBackendName }
+func (r *rsyncBackend) Destination() string { return r.destination }
+func (r *rsyncBackend) Close() error        { return nil }
+
+// DeliverBag runs rsync with --partial so an interrupted transfer resumes, numWorkers is not used
+func (r *rsyncBackend) DeliverBag(bag string, numWorkers int) bagDelivery {
+	bagName := filepath.Base(bag)
+	delivery := bagDelivery{Bag: bagName}
+	start := time.Now()
+
+	args := []string{"-a", "--partial", "--stats", "--out-format=  * %o %n: %l bytes"}
+	if r.sshTarget != "" {
+		args = append(args, "-e", r.sshCommand())
+	}
+	args = append(args, strings.TrimSuffix(bag, string(filepath.Separator))+string(filepath.Separator), joinDestination(r.destination, bagName, ""))
+
+	rsyncCmd := exec.Command("rsync", args...)
+	stdout, err := rsyncCmd.StdoutPipe()
+	if err != nil {
+		delivery.Err = err
+		return delivery
+	}
+	stderr := &strings.Builder{}
+	rsyncCmd.Stderr = stderr
+
+	if err := rsyncCmd.Start(); err != nil {
+		delivery.Err = err
+		return delivery
+	}
+
+	//print rsync's per-file lines as they arrive and keep the rest for its stats
+	output := &strings.Builder{}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "  * ") {
+			fmt.Println(line)
+			continue
+		}
+		output.WriteString(line + "\n")
+	}
+
+	err = rsyncCmd.Wait()
+	delivery.Duration = time.Since(start)
+	if err != nil {
+		delivery.Err = fmt.Errorf("rsync failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		return delivery
+	}
+
+	transferred := parseRsyncCount(rsyncFilesPtn, output.String())
+	delivery.Bytes = int64(parseRsyncCount(rsyncBytesPtn, output.String()))
+	numFiles, _, err := getDirectorySize(bag)
+	if err != nil {
+		delivery.Err = err
+		return delivery
+	}
+	delivery.NumFiles = numFiles
+	delivery.NumSkipped = numFiles - transferred
+
+	return delivery
+}
+
+func parseRsyncCount(ptn *regexp.Regexp, output string) int {
+	match := ptn.FindStringSubmatch(output)
+	if match == nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(strings.ReplaceAll(match[1], ",", ""))
+	return count
+}
+
+func (f *filesystemBackend) Open(p string) (io.ReadCloser, error) {
+	return os.Open(filepath.FromSlash(p))
+}
+
+// Open reads a delivered file back when rsync delivered to a local or mounted directory
+func (r *rsyncBackend) Open(p string) (io.ReadCloser, error) {
+	if r.sshTarget != "" {
+		return nil, fmt.Errorf("can not read back files from %s, use --remote-checksum", r.sshTarget)
+	}
+	return os.Open(filepath.FromSlash(p))
+}
+
+func (r *rsyncBackend) RemoteSHA256(paths []string) (map[string]string, error) {
+	if r.sshTarget == "" {
+		return nil, fmt.Errorf("%s is not a remote destination, verify without --remote-checksum", r.destination)
+	}
+
+	args := append(append([]string{}, r.sshArgs[1:]...), r.sshTarget, sha256SumCommand(paths))
+	output, err := exec.Command(r.sshArgs[0], args...).Output()
+
+	//sha256sum exits with 1 when some of the files could not be read
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		err = nil
+	}
+
+	return parseSHA256Sum(string(output)), err
+}
@@ -0,0 +1,27 @@
+package lib
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRsyncSSHCommand(t *testing.T) {
+	sshArgs := []string{"ssh", "-p", "22", "-i", "/home/erwt/ssh keys/id_ed25519", "-o", "UserKnownHostsFile=/home/erwt/it's known_hosts"}
+	backend := &rsyncBackend{sshArgs: sshArgs}
+
+	//rsync splits -e on spaces outside of quotes, as the shell does for these arguments
+	output, err := exec.Command("sh", "-c", `printf '%s\n' `+backend.sshCommand()).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	if strings.Join(got, "|") != strings.Join(sshArgs, "|") {
+		t.Errorf("got %q, want %q", got, sshArgs)
+	}
+
+	if strings.Contains(backend.sshCommand(), `\`) {
+		t.Errorf("%s has a backslash, which rsync does not treat as an escape", backend.sshCommand())
+	}
+}
@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nyudlts/go-aspace"
+)
+
+const doNotCreateDOs = "electronic_records-do-not-create-DOs"
+
+func AspaceCreateDOs(opts AspaceOptions, dryRun bool) error {
+	fmt.Printf("ewt aspace create-dos, %s\n", VERSION)
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	//get aspaceConfig
+	if err := getAspaceConfig(opts); err != nil {
+		return err
+	}
+
+	//get workorder
+	if err := findWorkOrder(); err != nil {
+		return err
+	}
+
+	//get transfer info
+	if err := getTransferInfo(); err != nil {
+		return err
+	}
+
+	if transferInfo.ContentType == doNotCreateDOs {
+		fmt.Printf("  * nyu-dl-content-type is %s, no digital objects will be created\n", doNotCreateDOs)
+		return nil
+	}
+
+	//create the DOs
+	if err := createDOs(dryRun); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createDOs(dryRun bool) error {
+	client, err := aspace.NewClient(aspaceConfigLoc, aspaceEnv, 20)
+	if err != nil {
+		return err
+	}
+
+	wo, err := parseWorkOrder(filepath.Dir(workOrderLocation), filepath.Base(workOrderLocation))
+	if err != nil {
+		return err
+	}
+
+	results := [][]string{}
+	created := 0
+	for _, row := range wo.Rows {
+		componentID := row.GetComponentID()
+		repoID, aoID, err := aspace.URISplit(row.GetURI())
+		if err != nil {
+			results = append(results, []string{row.GetURI(), componentID, "", "ERROR: not able to split uri"})
+			continue
+		}
+
+		ao, err := client.GetArchivalObject(repoID, aoID)
+		if err != nil {
+			fmt.Printf("  * [ERROR] AO does not exist: %s\n", row.GetURI())
+			results = append(results, []string{row.GetURI(), componentID, "", "ERROR: AO does not exist"})
+			continue
+		}
+
+		doURI, err := findMatchingDO(client, ao, componentID)
+		if err != nil {
+			results = append(results, []string{row.GetURI(), componentID, "", "ERROR: " + err.Error()})
+			continue
+		}
+
+		if doURI != "" {
+			fmt.Printf("  * %s already linked to %s\n", componentID, doURI)
+			results = append(results, []string{row.GetURI(), componentID, doURI, "EXISTS"})
+			continue
+		}
+
+		if dryRun {
+			fmt.Printf("  * [DRY-RUN] would create DO %s and link it to %s\n", componentID, row.GetURI())
+			results = append(results, []string{row.GetURI(), componentID, "", "DRY-RUN"})
+			continue
+		}
+
+		doURI, err = createAndLinkDO(client, repoID, aoID, ao, componentID)
+		if err != nil {
+			fmt.Printf("  * [ERROR] could not create DO for %s: %s\n", componentID, err.Error())
+			results = append(results, []string{row.GetURI(), componentID, doURI, "ERROR: " + err.Error()})
+			continue
+		}
+
+		fmt.Printf("  * created %s for %s\n", doURI, componentID)
+		results = append(results, []string{row.GetURI(), componentID, doURI, "CREATED"})
+		created++
+	}
+
+	outputFilename := currentProject().LogLoc("aspace-create-dos.tsv")
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	writer := csv.NewWriter(outputFile)
+	writer.Comma = '\t'
+	writer.Write([]string{"ao_uri", "component_id", "do_uri", "status"})
+	writer.WriteAll(results)
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	fmt.Printf("  * %d digital objects created, results written to %s\n", created, outputFilename)
+	return nil
+}
+
+// findMatchingDO returns the uri of a DO linked to the AO whose digital_object_id is the component id
+func findMatchingDO(client *aspace.ASClient, ao aspace.ArchivalObject, componentID string) (string, error) {
+	for _, instance := range ao.Instances {
+		if instance.InstanceType != "digital_object" {
+			continue
+		}
+
+		doURI := instance.DigitalObject["ref"]
+		do, err := client.GetDigitalObjectFromURI(doURI)
+		if err != nil {
+			return "", fmt.Errorf("not able to request %s", doURI)
+		}
+
+		if do.DigitalObjectID == componentID {
+			return doURI, nil
+		}
+	}
+	return "", nil
+}
+
+func createAndLinkDO(client *aspace.ASClient, repoID int, aoID int, ao aspace.ArchivalObject, componentID string) (string, error) {
+	do := aspace.DigitalObject{
+		DigitalObjectID: componentID,
+		Title:           ao.Title,
+		JSONModelType:   "digital_object",
+		Repository:      aspace.LinkedRepository{Ref: fmt.Sprintf("/repositories/%d", repoID)},
+	}
+
+	body, err := client.CreateDigitalObject(repoID, do)
+	if err != nil {
+		return "", err
+	}
+
+	response := aspace.ParseCreateOrUpdateResponse(body)
+	if response == nil || response.URI == "" {
+		return "", fmt.Errorf("unexpected response creating digital object: %s", body)
+	}
+
+	ao.Instances = append(ao.Instances, aspace.Instance{
+		InstanceType:  "digital_object",
+		JSONModelType: "instance",
+		DigitalObject: map[string]string{"ref": response.URI},
+	})
+
+	if _, err := client.UpdateArchivalObject(repoID, aoID, ao); err != nil {
+		return response.URI, fmt.Errorf("created %s but could not link it to %s: %w", response.URI, ao.URI, err)
+	}
+
+	return response.URI, nil
+}
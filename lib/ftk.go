@@ -0,0 +1,284 @@
+package lib
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FTKEntry is a single file row from an FTK file list export
+type FTKEntry struct {
+	Path string
+	Size int64
+	MD5  string
+	SHA1 string
+}
+
+// FTKDiscrepancy describes a difference between an FTK export and the files on disk
+type FTKDiscrepancy struct {
+	Type     string
+	Path     string
+	Expected string
+	Found    string
+}
+
+// FTKReport holds the result of reconciling an FTK export against an ER directory
+type FTKReport struct {
+	ComponentID   string
+	ExportPath    string
+	NumEntries    int
+	NumMatched    int
+	Discrepancies []FTKDiscrepancy
+}
+
+const (
+	ftkMissing          = "MISSING"
+	ftkExtra            = "EXTRA"
+	ftkSizeMismatch     = "SIZE MISMATCH"
+	ftkChecksumMismatch = "CHECKSUM MISMATCH"
+)
+
+var (
+	ftkPathColumns = []string{"full path", "path", "item path", "file path"}
+	ftkNameColumns = []string{"filename", "file name", "name"}
+	ftkSizeColumns = []string{"logical size", "size", "file size"}
+	ftkMD5Columns  = []string{"md5 hash", "md5", "md5 digest"}
+	ftkSHA1Columns = []string{"sha1 hash", "sha1", "sha-1", "sha1 digest"}
+)
+
+// ParseFTKExport reads an FTK CSV or TSV file list export, the delimiter is chosen from the file extension
+func ParseFTKExport(exportPath string) ([]FTKEntry, error) {
+	f, err := os.Open(exportPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if strings.ToLower(filepath.Ext(exportPath)) == ".tsv" {
+		reader.Comma = '\t'
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read header of %s: %w", exportPath, err)
+	}
+
+	columns := map[string]int{}
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+
+	pathCol := findFTKColumn(columns, ftkPathColumns)
+	nameCol := findFTKColumn(columns, ftkNameColumns)
+	if pathCol < 0 && nameCol < 0 {
+		return nil, fmt.Errorf("%s does not contain a path or filename column", exportPath)
+	}
+	sizeCol := findFTKColumn(columns, ftkSizeColumns)
+	md5Col := findFTKColumn(columns, ftkMD5Columns)
+	sha1Col := findFTKColumn(columns, ftkSHA1Columns)
+
+	entries := []FTKEntry{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := FTKEntry{Size: -1}
+		entry.Path = getFTKField(record, pathCol)
+		if entry.Path == "" {
+			entry.Path = getFTKField(record, nameCol)
+		}
+		if entry.Path == "" {
+			continue
+		}
+
+		if sizeString := strings.ReplaceAll(getFTKField(record, sizeCol), ",", ""); sizeString != "" {
+			size, err := strconv.ParseInt(sizeString, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size %q for %s in %s", sizeString, entry.Path, exportPath)
+			}
+			entry.Size = size
+		}
+		entry.MD5 = strings.ToLower(getFTKField(record, md5Col))
+		entry.SHA1 = strings.ToLower(getFTKField(record, sha1Col))
+
+		//folders are listed in exports without hashes
+		if entry.MD5 == "" && entry.SHA1 == "" && entry.Size <= 0 {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func findFTKColumn(columns map[string]int, names []string) int {
+	for _, name := range names {
+		if i, ok := columns[name]; ok {
+			return i
+		}
+	}
+	return -1
+}
+
+func getFTKField(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// ReconcileFTKExport compares the entries of an FTK export with the files in an ER directory
+func ReconcileFTKExport(exportPath string, erPath string) (FTKReport, error) {
+	report := FTKReport{ComponentID: filepath.Base(erPath), ExportPath: exportPath}
+
+	entries, err := ParseFTKExport(exportPath)
+	if err != nil {
+		return report, err
+	}
+	report.NumEntries = len(entries)
+
+	//index the files on disk by their path relative to the ER directory
+	onDisk := map[string]fs.FileInfo{}
+	if err := filepath.Walk(erPath, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(erPath, path)
+			if err != nil {
+				return err
+			}
+			onDisk[filepath.ToSlash(rel)] = info
+		}
+		return nil
+	}); err != nil {
+		return report, err
+	}
+
+	matched := map[string]bool{}
+	for _, entry := range entries {
+		rel, ok := matchFTKPath(entry.Path, onDisk, matched)
+		if !ok {
+			report.Discrepancies = append(report.Discrepancies, FTKDiscrepancy{ftkMissing, entry.Path, "", ""})
+			continue
+		}
+		matched[rel] = true
+
+		info := onDisk[rel]
+		if entry.Size >= 0 && entry.Size != info.Size() {
+			report.Discrepancies = append(report.Discrepancies, FTKDiscrepancy{ftkSizeMismatch, rel, strconv.FormatInt(entry.Size, 10), strconv.FormatInt(info.Size(), 10)})
+			continue
+		}
+
+		md5Sum, sha1Sum, err := hashFile(filepath.Join(erPath, filepath.FromSlash(rel)), entry.MD5 != "", entry.SHA1 != "")
+		if err != nil {
+			return report, err
+		}
+		if entry.MD5 != "" && entry.MD5 != md5Sum {
+			report.Discrepancies = append(report.Discrepancies, FTKDiscrepancy{ftkChecksumMismatch, rel, "md5:" + entry.MD5, "md5:" + md5Sum})
+			continue
+		}
+		if entry.SHA1 != "" && entry.SHA1 != sha1Sum {
+			report.Discrepancies = append(report.Discrepancies, FTKDiscrepancy{ftkChecksumMismatch, rel, "sha1:" + entry.SHA1, "sha1:" + sha1Sum})
+			continue
+		}
+		report.NumMatched++
+	}
+
+	extras := []string{}
+	for rel := range onDisk {
+		if !matched[rel] {
+			extras = append(extras, rel)
+		}
+	}
+	sort.Strings(extras)
+	for _, rel := range extras {
+		report.Discrepancies = append(report.Discrepancies, FTKDiscrepancy{ftkExtra, rel, "", ""})
+	}
+
+	return report, nil
+}
+
+// matchFTKPath finds the file on disk whose relative path is the longest suffix of the FTK path,
+// FTK paths are rooted in the disk image (e.g. `ER_1.E01/Partition 1/NONAME [FAT12]/[root]/...`)
+func matchFTKPath(ftkPath string, onDisk map[string]fs.FileInfo, matched map[string]bool) (string, bool) {
+	parts := strings.FieldsFunc(ftkPath, func(r rune) bool { return r == '/' || r == '\\' })
+	for i := range parts {
+		candidate := strings.Join(parts[i:], "/")
+		if _, ok := onDisk[candidate]; ok && !matched[candidate] {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func hashFile(path string, withMD5 bool, withSHA1 bool) (string, string, error) {
+	if !withMD5 && !withSHA1 {
+		return "", "", nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	md5Hash := md5.New()
+	sha1Hash := sha1.New()
+	writers := []io.Writer{}
+	if withMD5 {
+		writers = append(writers, md5Hash)
+	}
+	if withSHA1 {
+		writers = append(writers, sha1Hash)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return "", "", err
+	}
+
+	return hexSum(md5Hash), hexSum(sha1Hash), nil
+}
+
+func hexSum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// findFTKExports returns a map of component ids to FTK exports in a SIP metadata directory
+func findFTKExports(mdDir string) (map[string]string, error) {
+	exports := map[string]string{}
+	mdFiles, err := os.ReadDir(mdDir)
+	if err != nil {
+		return exports, err
+	}
+
+	for _, mdFile := range mdFiles {
+		name := mdFile.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if mdFile.IsDir() || (ext != ".tsv" && ext != ".csv") || strings.Contains(name, "_aspace_wo.tsv") {
+			continue
+		}
+		exports[strings.TrimSuffix(name, filepath.Ext(name))] = filepath.Join(mdDir, name)
+	}
+
+	return exports, nil
+}
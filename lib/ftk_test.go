@@ -0,0 +1,201 @@
+package lib
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFTKExport writes an export named for the format, e.g. `ER_1.csv`, in a temporary directory
+func writeFTKExport(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	exportPath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(exportPath, []byte(content), 0664); err != nil {
+		t.Fatal(err)
+	}
+	return exportPath
+}
+
+func TestParseFTKExport(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []FTKEntry
+	}{
+		{
+			"csv",
+			"ER_1.csv",
+			"Full Path,Logical Size,MD5 Hash,SHA1 Hash\n" +
+				"ER_1.E01/[root]/a.txt,\"1,024\",ABCDEF,012345\n",
+			[]FTKEntry{{"ER_1.E01/[root]/a.txt", 1024, "abcdef", "012345"}},
+		},
+		{
+			"tsv",
+			"ER_1.tsv",
+			"Path\tSize\tMD5\n" +
+				"ER_1.E01/[root]/a, b.txt\t12\tabcdef\n",
+			[]FTKEntry{{"ER_1.E01/[root]/a, b.txt", 12, "abcdef", ""}},
+		},
+		{
+			"column aliases and byte order mark",
+			"ER_1.csv",
+			"\ufeffFile Name,File Size,MD5 Digest,SHA-1\n" +
+				"a.txt,12,abcdef,012345\n",
+			[]FTKEntry{{"a.txt", 12, "abcdef", "012345"}},
+		},
+		{
+			"path falls back to the filename",
+			"ER_1.csv",
+			"Item Path,Name,Size,MD5\n" +
+				",a.txt,12,abcdef\n",
+			[]FTKEntry{{"a.txt", 12, "abcdef", ""}},
+		},
+		{
+			"folder rows are skipped",
+			"ER_1.csv",
+			"Full Path,Logical Size,MD5 Hash\n" +
+				"ER_1.E01/[root]/folder,0,\n" +
+				"ER_1.E01/[root]/other folder,,\n" +
+				"ER_1.E01/[root]/folder/a.txt,12,abcdef\n",
+			[]FTKEntry{{"ER_1.E01/[root]/folder/a.txt", 12, "abcdef", ""}},
+		},
+		{
+			"no size",
+			"ER_1.csv",
+			"Full Path,MD5 Hash\n" +
+				"a.txt,abcdef\n",
+			[]FTKEntry{{"a.txt", -1, "abcdef", ""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFTKExport(writeFTKExport(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("no path column", func(t *testing.T) {
+		_, err := ParseFTKExport(writeFTKExport(t, "ER_1.csv", "Logical Size,MD5 Hash\n12,abcdef\n"))
+		if err == nil || !strings.Contains(err.Error(), "path or filename column") {
+			t.Errorf("got %v, want a missing path column error", err)
+		}
+	})
+
+	t.Run("invalid size", func(t *testing.T) {
+		_, err := ParseFTKExport(writeFTKExport(t, "ER_1.csv", "Full Path,Logical Size\na.txt,twelve\n"))
+		if err == nil || !strings.Contains(err.Error(), "invalid size") {
+			t.Errorf("got %v, want an invalid size error", err)
+		}
+	})
+}
+
+func TestReconcileFTKExport(t *testing.T) {
+	//files in the ER directory, two with the same basename
+	files := map[string]string{
+		"a.txt":          "content a\n",
+		"one/report.doc": "report one\n",
+		"two/report.doc": "report two\n",
+	}
+
+	md5Of := func(content string) string {
+		sum := md5.Sum([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+	sha1Of := func(content string) string {
+		sum := sha1.Sum([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+	row := func(path string, content string) string {
+		return fmt.Sprintf("ER_1.E01/Partition 1/NONAME [FAT12]/[root]/%s,%d,%s,%s\n", path, len(content), md5Of(content), sha1Of(content))
+	}
+	allRows := row("a.txt", files["a.txt"]) + row("one/report.doc", files["one/report.doc"]) + row("two/report.doc", files["two/report.doc"])
+
+	tests := []struct {
+		name        string
+		rows        string
+		wantMatched int
+		want        []FTKDiscrepancy
+	}{
+		{"all files match", allRows, 3, nil},
+		{
+			"duplicate basenames match the longest suffix",
+			row("two/report.doc", files["two/report.doc"]) + row("one/report.doc", files["one/report.doc"]) + row("a.txt", files["a.txt"]),
+			3,
+			nil,
+		},
+		{
+			"missing",
+			allRows + row("b.txt", "content b\n"),
+			3,
+			[]FTKDiscrepancy{{ftkMissing, "ER_1.E01/Partition 1/NONAME [FAT12]/[root]/b.txt", "", ""}},
+		},
+		{
+			"extra",
+			row("a.txt", files["a.txt"]) + row("one/report.doc", files["one/report.doc"]),
+			2,
+			[]FTKDiscrepancy{{ftkExtra, "two/report.doc", "", ""}},
+		},
+		{
+			"size mismatch",
+			row("a.txt", "content a, longer\n") + row("one/report.doc", files["one/report.doc"]) + row("two/report.doc", files["two/report.doc"]),
+			2,
+			[]FTKDiscrepancy{{ftkSizeMismatch, "a.txt", "18", "10"}},
+		},
+		{
+			"md5 mismatch",
+			row("a.txt", "content A\n") + row("one/report.doc", files["one/report.doc"]) + row("two/report.doc", files["two/report.doc"]),
+			2,
+			[]FTKDiscrepancy{{ftkChecksumMismatch, "a.txt", "md5:" + md5Of("content A\n"), "md5:" + md5Of(files["a.txt"])}},
+		},
+		{
+			"sha1 mismatch",
+			fmt.Sprintf("[root]/a.txt,%d,,%s\n", len(files["a.txt"]), sha1Of("content A\n")) + row("one/report.doc", files["one/report.doc"]) + row("two/report.doc", files["two/report.doc"]),
+			2,
+			[]FTKDiscrepancy{{ftkChecksumMismatch, "a.txt", "sha1:" + sha1Of("content A\n"), "sha1:" + sha1Of(files["a.txt"])}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			erPath := filepath.Join(t.TempDir(), "ER_1")
+			for name, content := range files {
+				p := filepath.Join(erPath, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(p), 0775); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(content), 0664); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			exportPath := writeFTKExport(t, "ER_1.csv", "Full Path,Logical Size,MD5 Hash,SHA1 Hash\n"+tt.rows)
+			report, err := ReconcileFTKExport(exportPath, erPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if report.ComponentID != "ER_1" || report.NumMatched != tt.wantMatched {
+				t.Errorf("got %s with %d matched, want ER_1 with %d", report.ComponentID, report.NumMatched, tt.wantMatched)
+			}
+
+			if !reflect.DeepEqual(report.Discrepancies, tt.want) {
+				t.Errorf("got %+v, want %+v", report.Discrepancies, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// siteConfigLoc holds the site-wide defaults for every project on the host
+var siteConfigLoc = filepath.Join("/etc", "erwt", "config.yml")
+
+const (
+	defaultConfigSource = "default"
+	projectDirSource    = "project directory"
+	configEnvPrefix     = "ERWT_"
+)
+
+// ConfigShowOptions holds the settings for `config show`
+type ConfigShowOptions struct {
+	Effective bool
+}
+
+// ConfigLayer is one of the sources merged into a project's config, in the order they are applied
+type ConfigLayer struct {
+	Name  string
+	Loc   string
+	Found bool
+}
+
+// layeredConfig is the result of merging the built-in defaults, the site, user and project config.yml and the ERWT_*
+// environment variables, with the source of each value keyed by its config key, e.g. `bag-info-profile.bagit-profile`
+type layeredConfig struct {
+	Config  Config
+	Sources map[string]string
+	Layers  []ConfigLayer
+}
+
+// defaultConfig is the bottom layer of the config, the service configs default to the user's config directory rather
+// than assuming it is under /home
+func defaultConfig() Config {
+	c := Config{
+		SIPLoc:          "sip",
+		AIPLoc:          "aips",
+		LogLoc:          "logs",
+		XferLoc:         "xfer",
+		AspaceEnv:       defaultAspaceEnv,
+		AspaceStaffURL:  defaultAspaceStaffURL,
+		DeliveryBackend: sftpBackendName,
+	}
+
+	if userConfigDir, err := os.UserConfigDir(); err == nil {
+		c.AspaceConfigLoc = filepath.Join(userConfigDir, "go-aspace.yml")
+		c.AmaticaConfigLoc = filepath.Join(userConfigDir, "go-archivematica.yml")
+	}
+
+	return c
+}
+
+// userConfigLoc returns the location of the user's erwt config, `<user config dir>/erwt/config.yml`
+func userConfigLoc() string {
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(userConfigDir, "erwt", "config.yml")
+}
+
+// loadLayeredConfig merges the built-in defaults, the site config, the user config, the project's config.yml, if
+// given, and the ERWT_* environment variables, later layers overriding the values set by earlier ones. Empty values do
+// not override, and relative locations are resolved against the project directory.
+func loadLayeredConfig(projectConfigLoc string) (layeredConfig, error) {
+	layered := layeredConfig{Sources: map[string]string{}}
+	mergeConfig(reflect.ValueOf(&layered.Config).Elem(), reflect.ValueOf(defaultConfig()), "", defaultConfigSource, layered.Sources)
+	layered.Layers = append(layered.Layers, ConfigLayer{Name: "default", Loc: "built in", Found: true})
+
+	fileLayers := []ConfigLayer{{Name: "site", Loc: siteConfigLoc}, {Name: "user", Loc: userConfigLoc()}}
+	if projectConfigLoc != "" {
+		fileLayers = append(fileLayers, ConfigLayer{Name: "project", Loc: projectConfigLoc})
+	}
+
+	for _, layer := range fileLayers {
+		layerConfig, found, err := readConfigLayer(layer.Loc)
+		if err != nil {
+			return layered, err
+		}
+
+		if !found && layer.Name == "project" {
+			return layered, fmt.Errorf("project config %s not found", layer.Loc)
+		}
+
+		layer.Found = found
+		layered.Layers = append(layered.Layers, layer)
+		mergeConfig(reflect.ValueOf(&layered.Config).Elem(), reflect.ValueOf(layerConfig), "", layer.Loc, layered.Sources)
+	}
+
+	applyEnvConfig(reflect.ValueOf(&layered.Config).Elem(), "", layered.Sources)
+	layered.Layers = append(layered.Layers, ConfigLayer{Name: "environment", Loc: configEnvPrefix + "*", Found: true})
+
+	if projectConfigLoc != "" {
+		dir := filepath.Dir(projectConfigLoc)
+		if layered.Config.ProjectLoc == "" {
+			layered.Config.ProjectLoc = dir
+			layered.Sources["project-location"] = projectDirSource
+		}
+
+		c := &layered.Config
+		for _, loc := range []*string{&c.SIPLoc, &c.SourceLoc, &c.AIPLoc, &c.LogLoc, &c.XferLoc, &c.ArchiveLoc, &c.BagInfoProfile.BagItProfile} {
+			if *loc != "" && !filepath.IsAbs(*loc) {
+				*loc = filepath.Join(dir, *loc)
+			}
+		}
+	}
+
+	return layered, nil
+}
+
+// readConfigLayer reads one of the config files, reporting whether it exists
+func readConfigLayer(configLoc string) (Config, bool, error) {
+	layerConfig := Config{}
+	if configLoc == "" {
+		return layerConfig, false, nil
+	}
+
+	b, err := os.ReadFile(configLoc)
+	if os.IsNotExist(err) {
+		return layerConfig, false, nil
+	} else if err != nil {
+		return layerConfig, false, err
+	}
+
+	if err := yaml.Unmarshal(b, &layerConfig); err != nil {
+		return layerConfig, true, fmt.Errorf("could not parse %s: %w", configLoc, err)
+	}
+
+	return layerConfig, true, nil
+}
+
+// configKey returns the config key of a field, nested keys are joined with a `.`
+func configKey(prefix string, field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// configEnvName returns the environment variable that overrides a config key, `aspace-staff-url` is set by
+// ERWT_ASPACE_STAFF_URL
+func configEnvName(key string) string {
+	return configEnvPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+}
+
+// mergeConfig copies the values set in src over dst, recording source as where each of them came from
+func mergeConfig(dst reflect.Value, src reflect.Value, prefix string, source string, sources map[string]string) {
+	for i := 0; i < src.NumField(); i++ {
+		key := configKey(prefix, src.Type().Field(i))
+		if src.Field(i).Kind() == reflect.Struct {
+			mergeConfig(dst.Field(i), src.Field(i), key, source, sources)
+			continue
+		}
+
+		if !src.Field(i).IsZero() {
+			dst.Field(i).Set(src.Field(i))
+			sources[key] = source
+		}
+	}
+}
+
+// applyEnvConfig sets the config values given in ERWT_* environment variables, lists are comma separated
+func applyEnvConfig(dst reflect.Value, prefix string, sources map[string]string) {
+	for i := 0; i < dst.NumField(); i++ {
+		key := configKey(prefix, dst.Type().Field(i))
+		field := dst.Field(i)
+		if field.Kind() == reflect.Struct {
+			applyEnvConfig(field, key, sources)
+			continue
+		}
+
+		envName := configEnvName(key)
+		value := os.Getenv(envName)
+		if value == "" {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Slice:
+			values := []string{}
+			for _, v := range strings.Split(value, ",") {
+				values = append(values, strings.TrimSpace(v))
+			}
+			field.Set(reflect.ValueOf(values))
+		default:
+			continue
+		}
+		sources[key] = envName
+	}
+}
+
+// ShowConfig prints the project's config.yml, or with Effective the config merged from every layer and the source of
+// each value
+func ShowConfig(opts ConfigShowOptions) error {
+	fmt.Printf("ewt config show, %s\n", VERSION)
+
+	configLoc, err := FindConfig()
+	if !opts.Effective {
+		if err != nil {
+			return err
+		}
+
+		b, err := os.ReadFile(configLoc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  * %s\n", configLoc)
+		fmt.Print(string(b))
+		return nil
+	}
+
+	//the site, user and environment config still apply outside of a project
+	if err != nil {
+		fmt.Println("  * no project config.yml found")
+		configLoc = ""
+	}
+
+	layered, err := loadLayeredConfig(configLoc)
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range layered.Layers {
+		if layer.Found {
+			fmt.Printf("  * %s: %s\n", layer.Name, layer.Loc)
+		} else {
+			fmt.Printf("  * %s: %s (not found)\n", layer.Name, layer.Loc)
+		}
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "KEY\tVALUE\tSOURCE")
+	printConfigValues(table, reflect.ValueOf(layered.Config), "", layered.Sources)
+	table.Flush()
+
+	fmt.Println("  * command line flags override these values for the command they are given to")
+	return nil
+}
+
+func printConfigValues(table *tabwriter.Writer, v reflect.Value, prefix string, sources map[string]string) {
+	for i := 0; i < v.NumField(); i++ {
+		key := configKey(prefix, v.Type().Field(i))
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			printConfigValues(table, field, key, sources)
+			continue
+		}
+
+		value := fmt.Sprint(field.Interface())
+		if field.Kind() == reflect.Slice {
+			value = strings.Join(field.Interface().([]string), ",")
+		}
+
+		source := firstNonEmpty(sources[key], "-")
+		fmt.Fprintf(table, "%s\t%s\t%s\n", key, firstNonEmpty(value, "-"), source)
+	}
+}
@@ -1,118 +1,275 @@
 package lib
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"embed"
 	"fmt"
-	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 
+	"github.com/nyudlts/go-aspace"
 	"gopkg.in/yaml.v2"
 )
 
 //go:embed ewt-config.yml
 var vfs embed.FS
 
-var (
-	collectionCode string
-	sourceLoc      string
-	projectLoc     string
-)
+// templateFS holds a project template for each partner, `templates/<partner-code>.yml`, with the config.yml defaults
+// for the partner's projects and the values expected in their transfer-info.txt
+//
+//go:embed templates
+var templateFS embed.FS
+
+// collection codes are `<partner-code>_<collection-id>`
+var collectionCodePtn = regexp.MustCompile(`^([a-z]+)_[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// projectDirs are created in each project directory
+var projectDirs = []string{"aips", "logs", filepath.Join("logs", "rsync"), "sip", "xfer"}
+
+// InitOptions holds the settings for `project init`
+type InitOptions struct {
+	CollectionCode  string
+	SourceLoc       string
+	PartnerCode     string
+	TransferSource  string
+	WorkOrderLoc    string
+	TransferInfoLoc string
+	Update          bool
+}
 
-func InitProject(cCode string, sLoc string) error {
-	fmt.Println("ewt project init, versions", VERSION)
+// projectTemplate holds the transfer-info.txt values expected for a partner, the rest of the template is config.yml
+// defaults
+type projectTemplate struct {
+	TransferInfo map[string]string `yaml:"transfer-info"`
+}
 
-	collectionCode = cCode
-	sourceLoc = sLoc
+func InitProject(opts InitOptions) error {
+	fmt.Println("ewt project init, version", VERSION)
+
+	//check the options
+	if err := validateInitOptions(&opts); err != nil {
+		return err
+	}
 
 	//generate ewt config
-	if err := generateConfig(); err != nil {
+	template, err := generateConfig(opts)
+	if err != nil {
 		return err
 	}
 
+	_, err = os.Stat(config.ProjectLoc)
+	projectExists := err == nil
+	if projectExists && !opts.Update {
+		return fmt.Errorf("%s already exists, use --update to repair it", config.ProjectLoc)
+	}
+
+	//an existing project keeps its transfer source, which updateEWTConfig checks
+	if config.AMTransferSource == "" && !projectExists {
+		return fmt.Errorf("the %s project template has no archivematica transfer source, set it with --transfer-source", opts.PartnerCode)
+	}
+
 	//make project directory
-	if err := mkProjectDir(); err != nil {
+	if err := mkProjectDir(projectExists); err != nil {
 		return err
 	}
 
-	//write the ewt-config to the project directory
-	if err := writeEWTConfig(); err != nil {
+	//write the ewt-config to the project directory, or add any keys missing from an existing one
+	if projectExists {
+		err = updateEWTConfig()
+	} else {
+		err = writeEWTConfig()
+	}
+	if err != nil {
+		return err
+	}
+
+	//copy the work order and transfer-info.txt to the sip's metadata directory
+	if err := copyProjectMetadata(opts, template); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func generateConfig() error {
+// validateInitOptions checks the collection code, partner code and source location, and that any work order or
+// transfer-info.txt to copy can be read
+func validateInitOptions(opts *InitOptions) error {
+	matches := collectionCodePtn.FindStringSubmatch(opts.CollectionCode)
+	if matches == nil {
+		return fmt.Errorf("collection code %q is malformed, must be in the form `<partner-code>_<collection-id>`", opts.CollectionCode)
+	}
+
+	if opts.PartnerCode == "" {
+		opts.PartnerCode = matches[1]
+	}
+
+	partners, err := getPartnerCodes()
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(partners, opts.PartnerCode) {
+		return fmt.Errorf("partner code %q has no project template, partner code must be one of: %s", opts.PartnerCode, strings.Join(partners, ", "))
+	}
+
+	//the source location may be left out when updating a project, which keeps its current source location
+	if opts.SourceLoc == "" && !opts.Update {
+		return fmt.Errorf("no source location given")
+	}
+
+	if opts.SourceLoc != "" {
+		info, err := os.Stat(opts.SourceLoc)
+		if err != nil {
+			return fmt.Errorf("source location %s: %w", opts.SourceLoc, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("source location %s is not a directory", opts.SourceLoc)
+		}
+	}
+
+	if opts.WorkOrderLoc != "" {
+		if !strings.HasSuffix(opts.WorkOrderLoc, "_aspace_wo.tsv") {
+			return fmt.Errorf("work order %s must be named `<name>_aspace_wo.tsv`", opts.WorkOrderLoc)
+		}
+
+		workOrderFile, err := os.Open(opts.WorkOrderLoc)
+		if err != nil {
+			return err
+		}
+		defer workOrderFile.Close()
+
+		workOrder := aspace.WorkOrder{}
+		if err := workOrder.Load(workOrderFile); err != nil {
+			return fmt.Errorf("could not load work order %s: %w", opts.WorkOrderLoc, err)
+		}
+	}
+
+	if opts.TransferInfoLoc != "" {
+		if _, err := readTransferInfo(opts.TransferInfoLoc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getPartnerCodes lists the partner codes that have a project template
+func getPartnerCodes() ([]string, error) {
+	entries, err := templateFS.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+
+	partners := []string{}
+	for _, entry := range entries {
+		partners = append(partners, strings.TrimSuffix(entry.Name(), ".yml"))
+	}
+	sort.Strings(partners)
+
+	return partners, nil
+}
+
+func readTransferInfo(transferInfoLoc string) (map[string]string, error) {
+	b, err := os.ReadFile(transferInfoLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	transferInfo := map[string]string{}
+	if err := yaml.Unmarshal(b, &transferInfo); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", transferInfoLoc, err)
+	}
+
+	return transferInfo, nil
+}
+
+// generateConfig layers the embedded config, the partner's project template and the options, returning the template
+func generateConfig(opts InitOptions) (projectTemplate, error) {
 	fmt.Println("  * generating ewt config")
 
 	//read the initial file
 	configBytes, err := vfs.ReadFile("ewt-config.yml")
 	if err != nil {
-		return err
+		return projectTemplate{}, err
 	}
 
 	//unmarshal to config options
 	config = Config{}
 	if err := yaml.Unmarshal(configBytes, &config); err != nil {
-		return err
+		return projectTemplate{}, err
+	}
+
+	//apply the partner's template
+	templateBytes, err := templateFS.ReadFile(path.Join("templates", opts.PartnerCode+".yml"))
+	if err != nil {
+		return projectTemplate{}, err
+	}
+
+	if err := yaml.Unmarshal(templateBytes, &config); err != nil {
+		return projectTemplate{}, err
+	}
+
+	template := projectTemplate{}
+	if err := yaml.Unmarshal(templateBytes, &template); err != nil {
+		return projectTemplate{}, err
 	}
 
 	//add config members
-	config.PartnerCode = strings.Split(collectionCode, "_")[0]
-	config.CollectionCode = collectionCode
+	config.PartnerCode = opts.PartnerCode
+	config.CollectionCode = opts.CollectionCode
 	wd, err := os.Getwd()
 	if err != nil {
-		return err
+		return projectTemplate{}, err
 	}
 
-	config.ProjectLoc = filepath.Join(wd, collectionCode)
+	config.ProjectLoc = filepath.Join(wd, opts.CollectionCode)
 	config.SIPLoc = filepath.Join(config.ProjectLoc, "sip")
 	config.AIPLoc = filepath.Join(config.ProjectLoc, "aips")
 	config.LogLoc = filepath.Join(config.ProjectLoc, "logs")
 	config.XferLoc = filepath.Join(config.ProjectLoc, "xfer")
-	config.SourceLoc, err = filepath.Abs(sourceLoc)
-	if err != nil {
-		return err
+	if opts.SourceLoc != "" {
+		config.SourceLoc, err = filepath.Abs(opts.SourceLoc)
+		if err != nil {
+			return projectTemplate{}, err
+		}
 	}
 
-	return nil
+	if opts.TransferSource != "" {
+		config.AMTransferSource = opts.TransferSource
+	}
+
+	return template, nil
 }
 
-func mkProjectDir() error {
+// mkProjectDir creates the project directory and its subdirectories, or those missing from an existing project
+func mkProjectDir(update bool) error {
 	fmt.Println("  * generating ewt project directory")
 
 	//create the project directory
-	if err := os.Mkdir(config.ProjectLoc, 0775); err != nil {
-		return err
-	}
-
-	//create the aips directory
-	if err := os.Mkdir(filepath.Join(config.ProjectLoc, "aips"), 0775); err != nil {
-		return err
-	}
-
-	//create the logs directory
-	if err := os.Mkdir(filepath.Join(config.ProjectLoc, "logs"), 0775); err != nil {
-		return err
+	if !update {
+		if err := os.Mkdir(config.ProjectLoc, 0775); err != nil {
+			return err
+		}
 	}
 
-	//create the resync output directory
-	if err := os.Mkdir(filepath.Join(config.ProjectLoc, "logs", "rsync"), 0775); err != nil {
-		return err
-	}
+	//create the aips, logs, rsync output, sip and xfer directories
+	for _, dir := range projectDirs {
+		dirLoc := filepath.Join(config.ProjectLoc, dir)
+		if _, err := os.Stat(dirLoc); err == nil {
+			continue
+		}
 
-	//create the sip output directory
-	if err := os.Mkdir(filepath.Join(config.ProjectLoc, "sip"), 0775); err != nil {
-		return err
-	}
+		if err := os.Mkdir(dirLoc, 0775); err != nil {
+			return err
+		}
 
-	//create the xfer directory
-	if err := os.Mkdir(filepath.Join(config.ProjectLoc, "xfer"), 0775); err != nil {
-		return err
+		if update {
+			fmt.Printf("  * created missing directory %s\n", dirLoc)
+		}
 	}
 
 	return nil
@@ -136,99 +293,144 @@ func writeEWTConfig() error {
 	return nil
 }
 
-func ArchiveProject(pl string) error {
-	fmt.Println("ewt project archive, version", VERSION)
-	projectLoc = pl
+// updateEWTConfig adds the keys missing from, or empty in, an existing project's config.yml, leaving the values that
+// are already set and any keys erwt does not know about
+func updateEWTConfig() error {
+	configLoc := filepath.Join(config.ProjectLoc, "config.yml")
+	existingBytes, err := os.ReadFile(configLoc)
+	if os.IsNotExist(err) {
+		fmt.Println("  * config.yml missing from project directory")
+		return writeEWTConfig()
+	} else if err != nil {
+		return err
+	}
 
-	// Remove AIP Directory
-	fmt.Println("  * removing aips directory")
-	aipsDir := filepath.Join(projectLoc, "aips")
-	if err := os.RemoveAll(aipsDir); err != nil {
-		panic(err)
+	fmt.Println("  * updating ewt config in project directory")
+
+	existing := yaml.MapSlice{}
+	if err := yaml.Unmarshal(existingBytes, &existing); err != nil {
+		return fmt.Errorf("could not parse %s: %w", configLoc, err)
 	}
 
-	// Remove XferDIrectory
-	fmt.Println("  * removing xfer directory")
-	xferDir := filepath.Join(projectLoc, "xfer")
-	if err := os.RemoveAll(xferDir); err != nil {
-		panic(err)
+	generatedBytes, err := yaml.Marshal(config)
+	if err != nil {
+		return err
 	}
 
-	// Create a gzip of the project
-	fmt.Println("  * compressing project directory")
-	if err := createGzip(); err != nil {
-		panic(err)
+	generated := yaml.MapSlice{}
+	if err := yaml.Unmarshal(generatedBytes, &generated); err != nil {
+		return err
 	}
 
-	// Remove the project directory
-	fmt.Println("  * removing project directory")
-	if err := os.RemoveAll(projectLoc); err != nil {
-		panic(err)
+	for _, item := range generated {
+		i := indexOfKey(existing, item.Key)
+		switch {
+		case i < 0:
+			existing = append(existing, item)
+			fmt.Printf("  * added missing config key %v\n", item.Key)
+		case item.Key == "collection-code" && existing[i].Value != item.Value:
+			return fmt.Errorf("%s has collection-code %v, not %v", configLoc, existing[i].Value, item.Value)
+		case isEmptyConfigValue(existing[i].Value) && !isEmptyConfigValue(item.Value):
+			existing[i].Value = item.Value
+			fmt.Printf("  * set empty config key %v\n", item.Key)
+		}
 	}
 
-	return nil
-}
+	if i := indexOfKey(existing, "archivematica-transfer-source"); i < 0 || isEmptyConfigValue(existing[i].Value) {
+		return fmt.Errorf("%s has no archivematica-transfer-source, set it with --transfer-source", configLoc)
+	}
 
-// Derived from: https://medium.com/@skdomino/taring-untaring-files-in-go-6b07cf56bc07
-func createGzip() error {
-	if _, err := os.Stat(projectLoc); err != nil {
+	b, err := yaml.Marshal(existing)
+	if err != nil {
 		return err
 	}
 
-	//create the gzip file
-	gzipName := filepath.Join("completed", fmt.Sprintf("%s.tgz", projectLoc))
-	gzipFile, err := os.Create(gzipName)
-	if err != nil {
+	if err := os.WriteFile(configLoc, b, 0755); err != nil {
 		return err
 	}
-	defer gzipFile.Close()
 
-	//create the gzip writer
-	gzipWriter := gzip.NewWriter(gzipFile)
-	defer gzipWriter.Close()
+	//reload the merged config
+	config = Config{}
+	return yaml.Unmarshal(b, &config)
+}
+
+func indexOfKey(items yaml.MapSlice, key interface{}) int {
+	for i, item := range items {
+		if item.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func isEmptyConfigValue(value interface{}) bool {
+	return value == nil || value == ""
+}
 
-	//create the tar writer
-	tarWriter := tar.NewWriter(gzipWriter)
-	defer tarWriter.Close()
+// copyProjectMetadata checks transfer-info.txt, if given, against the values in the partner's template and copies it
+// and the work order to the sip's metadata directory
+func copyProjectMetadata(opts InitOptions, template projectTemplate) error {
+	if opts.WorkOrderLoc == "" && opts.TransferInfoLoc == "" {
+		return nil
+	}
 
-	//walk the project location and add all files to the tar
-	return filepath.Walk(projectLoc, func(file string, fi os.FileInfo, err error) error {
-		//return an error
-		if err != nil {
-			return err
+	mdDir := currentProject().Paths().SIPMetadata
+	if err := os.MkdirAll(mdDir, 0775); err != nil {
+		return err
+	}
+
+	if opts.WorkOrderLoc != "" {
+		if workOrderName, err := getWorkOrderFile(mdDir); err == nil && workOrderName != filepath.Base(opts.WorkOrderLoc) {
+			return fmt.Errorf("%s already contains the work order %s", mdDir, workOrderName)
 		}
 
-		//return if the file is not regular
-		if !fi.Mode().IsRegular() {
-			return nil
+		if err := copyMetadataFile(opts.WorkOrderLoc, filepath.Join(mdDir, filepath.Base(opts.WorkOrderLoc))); err != nil {
+			return err
 		}
+	}
 
-		//create a new tar header
-		header, err := tar.FileInfoHeader(fi, fi.Name())
+	if opts.TransferInfoLoc != "" {
+		transferInfo, err := readTransferInfo(opts.TransferInfoLoc)
 		if err != nil {
 			return err
 		}
-		header.Name = strings.TrimPrefix(strings.Replace(file, projectLoc, "", -1), string(filepath.Separator))
 
-		//write the header
-		if err := tarWriter.WriteHeader(header); err != nil {
-			return err
+		keys := []string{}
+		for key := range template.TransferInfo {
+			keys = append(keys, key)
 		}
+		sort.Strings(keys)
 
-		//read the file
-		f, err := os.Open(file)
-		if err != nil {
-			return err
+		mismatches := []string{}
+		for _, key := range keys {
+			if transferInfo[key] != template.TransferInfo[key] {
+				mismatches = append(mismatches, fmt.Sprintf("%s is %q, expected %q", key, transferInfo[key], template.TransferInfo[key]))
+			}
+		}
+
+		if len(mismatches) > 0 {
+			return fmt.Errorf("%s does not match the %s project template: %s", opts.TransferInfoLoc, opts.PartnerCode, strings.Join(mismatches, "; "))
 		}
 
-		//copy the file data to the tar
-		if _, err := io.Copy(tarWriter, f); err != nil {
+		if err := copyMetadataFile(opts.TransferInfoLoc, filepath.Join(mdDir, "transfer-info.txt")); err != nil {
 			return err
 		}
+	}
 
-		//close the file
-		f.Close()
+	return nil
+}
 
+// copyMetadataFile copies a file into the sip's metadata directory, leaving a file that is already there
+func copyMetadataFile(src string, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		fmt.Printf("  * %s already exists, not copied\n", dst)
 		return nil
-	})
+	}
+
+	fmt.Printf("  * copying %s to %s\n", src, dst)
+	if _, err := copyFile(src, dst); err != nil {
+		return err
+	}
+
+	return nil
 }
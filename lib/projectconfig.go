@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nyudlts/go-aspace"
+	"gopkg.in/yaml.v2"
+)
+
+// projectDir is the project set with --project, which takes precedence over ERWT_PROJECT and searching for config.yml
+var projectDir string
+
+// Project is an erwt project directory and its config, merged from the defaults, the site and user configs, the
+// project's config.yml and the environment, with the relative locations in the config resolved against the project
+// directory. Sources records where each value came from, keyed by config key.
+type Project struct {
+	Dir     string
+	Config  Config
+	Sources map[string]string
+}
+
+// ProjectPaths are the locations of a project's working directories
+type ProjectPaths struct {
+	Project     string
+	Source      string
+	SIP         string
+	SIPMetadata string
+	Xfer        string
+	AIPs        string
+	Logs        string
+	Rsync       string
+}
+
+// SetProject sets the project directory, or its config.yml, to load the config from
+func SetProject(project string) {
+	projectDir = project
+}
+
+// FindConfig returns the location of the project's config.yml, from --project, ERWT_PROJECT or the first project
+// config.yml found searching up from the working directory
+func FindConfig() (string, error) {
+	if project := firstNonEmpty(projectDir, os.Getenv("ERWT_PROJECT")); project != "" {
+		configLoc := project
+		if info, err := os.Stat(project); err == nil && info.IsDir() {
+			configLoc = filepath.Join(project, "config.yml")
+		}
+
+		if err := checkProjectConfig(configLoc); err != nil {
+			return "", fmt.Errorf("no config.yml for project %s: %w", project, err)
+		}
+		return filepath.Abs(configLoc)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		//skip any config.yml that is not an erwt project's, such as one in a source tree or another tool's directory
+		configLoc := filepath.Join(dir, "config.yml")
+		if err := checkProjectConfig(configLoc); err == nil {
+			return configLoc, nil
+		}
+
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	return "", fmt.Errorf("no project config.yml found in %s or any parent directory, use --project or ERWT_PROJECT to select a project", wd)
+}
+
+// checkProjectConfig checks that a config.yml belongs to an erwt project, it must parse as a Config and set the
+// collection code
+func checkProjectConfig(configLoc string) error {
+	b, err := os.ReadFile(configLoc)
+	if err != nil {
+		return err
+	}
+
+	projectConfig := Config{}
+	if err := yaml.Unmarshal(b, &projectConfig); err != nil {
+		return fmt.Errorf("could not parse %s: %w", configLoc, err)
+	}
+
+	if projectConfig.CollectionCode == "" {
+		return fmt.Errorf("%s has no collection-code, it is not an erwt project config", configLoc)
+	}
+
+	return nil
+}
+
+// FindProject loads the project from --project, ERWT_PROJECT or the first config.yml found searching up from the
+// working directory
+func FindProject() (*Project, error) {
+	configLoc, err := FindConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadProject(filepath.Dir(configLoc))
+}
+
+// LoadProject loads a project's config, layering its config.yml over the defaults and the site and user configs,
+// and resolving relative locations against the project directory rather than the working directory
+func LoadProject(dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	layered, err := loadLayeredConfig(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Project{Dir: dir, Config: layered.Config, Sources: layered.Sources}, nil
+}
+
+// Paths returns the locations of the project's working directories
+func (p *Project) Paths() ProjectPaths {
+	return ProjectPaths{
+		Project:     p.Config.ProjectLoc,
+		Source:      p.Config.SourceLoc,
+		SIP:         p.Config.SIPLoc,
+		SIPMetadata: filepath.Join(p.Config.SIPLoc, "metadata"),
+		Xfer:        p.Config.XferLoc,
+		AIPs:        p.Config.AIPLoc,
+		Logs:        p.Config.LogLoc,
+		Rsync:       filepath.Join(p.Config.LogLoc, "rsync"),
+	}
+}
+
+// WorkOrderLoc returns the location of the work order in the sip's metadata directory
+func (p *Project) WorkOrderLoc() (string, error) {
+	mdDir := p.Paths().SIPMetadata
+	workOrderName, err := getWorkOrderFile(mdDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(mdDir, workOrderName), nil
+}
+
+// WorkOrder loads the work order in the sip's metadata directory
+func (p *Project) WorkOrder() (aspace.WorkOrder, error) {
+	workOrderLoc, err := p.WorkOrderLoc()
+	if err != nil {
+		return aspace.WorkOrder{}, err
+	}
+	return parseWorkOrder(filepath.Dir(workOrderLoc), filepath.Base(workOrderLoc))
+}
+
+// TransferInfoLoc returns the location of transfer-info.txt in the sip's metadata directory
+func (p *Project) TransferInfoLoc() string {
+	return filepath.Join(p.Paths().SIPMetadata, "transfer-info.txt")
+}
+
+// TransferInfo loads transfer-info.txt from the sip's metadata directory
+func (p *Project) TransferInfo() (TransferInfo, error) {
+	transferInfo := TransferInfo{}
+	b, err := os.ReadFile(p.TransferInfoLoc())
+	if err != nil {
+		return transferInfo, err
+	}
+
+	if err := yaml.Unmarshal(b, &transferInfo); err != nil {
+		return transferInfo, fmt.Errorf("could not parse %s: %w", p.TransferInfoLoc(), err)
+	}
+	return transferInfo, nil
+}
+
+// LogLoc returns the location of one of the project's logs or reports, `<log-location>/<collection-code>-<name>`
+func (p *Project) LogLoc(name string) string {
+	return filepath.Join(p.Config.LogLoc, fmt.Sprintf("%s-%s", p.Config.CollectionCode, name))
+}
+
+// CreateLog creates, or truncates, one of the project's logs or reports
+func (p *Project) CreateLog(name string) (*os.File, error) {
+	return os.Create(p.LogLoc(name))
+}
+
+// currentProject is the project whose config is loaded into the package config
+func currentProject() *Project {
+	return &Project{Dir: config.ProjectLoc, Config: config}
+}
+
+// loadConfig loads the current project's config into the package config
+func loadConfig() error {
+	project, err := FindProject()
+	if err != nil {
+		return err
+	}
+
+	config = project.Config
+	return nil
+}
+
+// loadProjectConfig loads a project's config into the package config
+func loadProjectConfig(projectLoc string) error {
+	project, err := LoadProject(projectLoc)
+	if err != nil {
+		return err
+	}
+
+	config = project.Config
+	return nil
+}
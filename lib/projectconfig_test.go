@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs map[string]string
+		want    string
+	}{
+		{"project config", map[string]string{"project/config.yml": "collection-code: cc\n"}, "project/config.yml"},
+		{"skips config without collection code", map[string]string{
+			"project/config.yml":            "collection-code: cc\n",
+			"project/sip/ER_1/config.yml":   "name: some other tool\n",
+			"project/sip/ER_1/a/config.yml": "- not a mapping\n",
+		}, "project/config.yml"},
+		{"no project config", map[string]string{"project/sip/ER_1/config.yml": "name: some other tool\n"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ERWT_PROJECT", "")
+			root := t.TempDir()
+			for name, content := range tt.configs {
+				if err := os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0775); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0664); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			wd := filepath.Join(root, "project", "sip", "ER_1", "a")
+			if err := os.MkdirAll(wd, 0775); err != nil {
+				t.Fatal(err)
+			}
+			t.Chdir(wd)
+
+			got, err := FindConfig()
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("found %s, want no project config", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, _ := filepath.EvalSymlinks(filepath.Join(root, tt.want))
+			if got, _ = filepath.EvalSymlinks(got); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// gaps in the processing chain, in the order a component moves through it
+const (
+	gapNotInWorkOrder   = "not in work order"
+	gapNotPackaged      = "no xfer package"
+	gapNeverTransferred = "never transferred"
+	gapFailedIngest     = "failed ingest"
+	gapMissingFromAIPs  = "missing from aips"
+	gapPrepFailed       = "prep failed"
+	gapNotDelivered     = "not delivered"
+	gapNotVerified      = "delivery verification failed"
+)
+
+var (
+	transferRequestedMatcher = regexp.MustCompile(`transfer processing requested for (\S+)-[0-9a-f-]{36}$`)
+	ingestCompletedMatcher   = regexp.MustCompile(`ingest processing completed for (\S+)-[0-9a-f-]{36}$`)
+)
+
+// reconcileRecord follows a single component id from the work order to R*
+type reconcileRecord struct {
+	ComponentID       string
+	Title             string
+	InWorkOrder       bool
+	XferPackage       string
+	XferPrepError     string
+	TransferRequested bool
+	IngestCompleted   bool
+	AIPUUID           string
+	AIPStoreLoc       string
+	StagedAIP         string
+	PrepStatus        string
+	DeliveryStatus    string
+	DeliveredAt       string
+	Verification      string
+}
+
+// gap returns the first stage of the chain the component did not get through, or an empty string if it was delivered
+func (r reconcileRecord) gap() string {
+	switch {
+	case !r.InWorkOrder:
+		return gapNotInWorkOrder
+	case r.XferPackage == "" && r.AIPStoreLoc == "":
+		return gapNotPackaged
+	case r.AIPStoreLoc == "" && !r.TransferRequested:
+		return gapNeverTransferred
+	case r.AIPStoreLoc == "":
+		return gapFailedIngest
+	case r.StagedAIP == "":
+		return gapMissingFromAIPs
+	case r.PrepStatus == "FAILED":
+		return gapPrepFailed
+	case r.DeliveryStatus != "OK":
+		return gapNotDelivered
+	case r.Verification == "FAILED":
+		return gapNotVerified
+	}
+	return ""
+}
+
+func ReconcileProject() error {
+	fmt.Printf("ewt project reconcile, %s\n", VERSION)
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	records, order, err := reconcileRecords()
+	if err != nil {
+		return err
+	}
+
+	//report
+	gaps := map[string]int{}
+	numGaps := 0
+	for _, componentID := range order {
+		if gap := records[componentID].gap(); gap != "" {
+			gaps[gap]++
+			numGaps++
+			fmt.Printf("  * %s: %s\n", componentID, gap)
+		}
+	}
+
+	reportLoc := currentProject().LogLoc("reconcile.tsv")
+	if err := writeReconcileReport(reportLoc, records, order); err != nil {
+		return err
+	}
+
+	fmt.Printf("  * %d of %d component ids complete\n", len(order)-numGaps, len(order))
+	for _, gap := range []string{gapNotInWorkOrder, gapNotPackaged, gapNeverTransferred, gapFailedIngest, gapMissingFromAIPs, gapPrepFailed, gapNotDelivered, gapNotVerified} {
+		if gaps[gap] > 0 {
+			fmt.Printf("    %s: %d\n", gap, gaps[gap])
+		}
+	}
+	fmt.Printf("  * report written to %s\n", reportLoc)
+
+	if numGaps > 0 {
+		return fmt.Errorf("%d of %d component ids have gaps", numGaps, len(order))
+	}
+
+	return nil
+}
+
+// reconcileRecords follows each component id in the work order, along with any others found on the way, through
+// the xfer packages, archivematica, the staged aips and their delivery to R*
+func reconcileRecords() (map[string]*reconcileRecord, []string, error) {
+	records, order, err := getWorkOrderRecords()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	getRecord := func(componentID string) *reconcileRecord {
+		record, found := records[componentID]
+		if !found {
+			record = &reconcileRecord{ComponentID: componentID}
+			records[componentID] = record
+			order = append(order, componentID)
+		}
+		return record
+	}
+
+	//xfer packages and the results of creating them
+	if err := reconcileXferPackages(getRecord); err != nil {
+		return nil, nil, err
+	}
+
+	//archivematica transfers and the aip-file
+	if err := reconcileAmatica(getRecord); err != nil {
+		return nil, nil, err
+	}
+
+	//staged and prepped aips
+	if err := reconcileStagedAIPs(getRecord); err != nil {
+		return nil, nil, err
+	}
+
+	//deliveries to R* and their verification
+	if err := reconcileDeliveries(records); err != nil {
+		return nil, nil, err
+	}
+
+	return records, order, nil
+}
+
+func getWorkOrderRecords() (map[string]*reconcileRecord, []string, error) {
+	if err := findWorkOrder(); err != nil {
+		return nil, nil, err
+	}
+
+	workOrder, err := parseWorkOrder(filepath.Dir(workOrderLocation), filepath.Base(workOrderLocation))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records := map[string]*reconcileRecord{}
+	order := []string{}
+	for _, row := range workOrder.Rows {
+		componentID := row.GetComponentID()
+		records[componentID] = &reconcileRecord{ComponentID: componentID, Title: row.GetTitle(), InWorkOrder: true}
+		order = append(order, componentID)
+	}
+
+	return records, order, nil
+}
+
+// reconcileXferPackages finds the `<collection-code>_<component-id>` packages in the xfer location and the errors
+// recorded when they were created
+func reconcileXferPackages(getRecord func(string) *reconcileRecord) error {
+	entries, err := os.ReadDir(config.XferLoc)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), config.CollectionCode+"_") {
+			getRecord(strings.TrimPrefix(entry.Name(), config.CollectionCode+"_")).XferPackage = filepath.Join(config.XferLoc, entry.Name())
+		}
+	}
+
+	rows, err := readReport(currentProject().LogLoc("xip-prep.tsv"))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if row["result"] == "ERROR" {
+			getRecord(row["component_id"]).XferPrepError = row["error"]
+		}
+	}
+
+	return nil
+}
+
+// reconcileAmatica reads the transfers requested from the archivematica transfer log and the aips from the aip-file
+func reconcileAmatica(getRecord func(string) *reconcileRecord) error {
+	amaticaLog, err := os.Open(currentProject().LogLoc("amatica-transfer.log"))
+	if err == nil {
+		defer amaticaLog.Close()
+		scanner := bufio.NewScanner(amaticaLog)
+		for scanner.Scan() {
+			if matches := transferRequestedMatcher.FindStringSubmatch(scanner.Text()); matches != nil {
+				getRecord(strings.TrimPrefix(filepath.Base(matches[1]), config.CollectionCode+"_")).TransferRequested = true
+			}
+			if matches := ingestCompletedMatcher.FindStringSubmatch(scanner.Text()); matches != nil {
+				getRecord(strings.TrimPrefix(filepath.Base(matches[1]), config.CollectionCode+"_")).IngestCompleted = true
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	//a project without an aip-file has not been ingested yet
+	aipFileLoc, err := findAIPFile()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	aipLocations, err := readAIPFile(aipFileLoc)
+	if err != nil {
+		return err
+	}
+
+	for _, aipLocation := range aipLocations {
+		componentID, aipUUID, err := parseAIPName(getAIPName(aipLocation))
+		if err != nil {
+			return fmt.Errorf("%s: %w", aipFileLoc, err)
+		}
+		record := getRecord(componentID)
+		record.AIPUUID = aipUUID
+		record.AIPStoreLoc = aipLocation
+	}
+
+	return nil
+}
+
+// reconcileStagedAIPs finds the aips in the aip location and the results of prepping them
+func reconcileStagedAIPs(getRecord func(string) *reconcileRecord) error {
+	entries, err := os.ReadDir(config.AIPLoc)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, entry := range entries {
+		componentID, aipUUID, err := parseAIPName(getAIPName(entry.Name()))
+		if err != nil {
+			continue
+		}
+		record := getRecord(componentID)
+		record.StagedAIP = filepath.Join(config.AIPLoc, entry.Name())
+		if record.AIPUUID == "" {
+			record.AIPUUID = aipUUID
+		}
+	}
+
+	rows, err := readReport(currentProject().LogLoc("aip-prep.tsv"))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if componentID, _, err := parseAIPName(row["aip"]); err == nil {
+			getRecord(componentID).PrepStatus = row["status"]
+		}
+	}
+
+	return nil
+}
+
+// reconcileDeliveries reads the latest delivery of each bag from the transfer log, and its verification from the sign-off
+func reconcileDeliveries(records map[string]*reconcileRecord) error {
+	byBag := map[string]*reconcileRecord{}
+	for _, record := range records {
+		if record.StagedAIP != "" {
+			byBag[filepath.Base(record.StagedAIP)] = record
+		}
+		if record.AIPStoreLoc != "" {
+			byBag[getAIPName(record.AIPStoreLoc)] = record
+		}
+	}
+
+	rows, err := readReport(currentProject().LogLoc("aip-transfer.tsv"))
+	if err != nil {
+		return err
+	}
+
+	//the transfer log is appended to on each run, so keep the first successful delivery or else the latest attempt
+	for _, row := range rows {
+		record, found := byBag[row["bag"]]
+		if !found || record.DeliveryStatus == "OK" {
+			continue
+		}
+		record.DeliveryStatus = row["status"]
+		record.DeliveredAt = row["timestamp"]
+	}
+
+	signOffBytes, err := os.ReadFile(currentProject().LogLoc("aip-verify-delivery-signoff.txt"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	signOff := struct {
+		Bags map[string]string `yaml:"bags"`
+	}{}
+	if err := yaml.Unmarshal(signOffBytes, &signOff); err != nil {
+		return err
+	}
+
+	for bag, status := range signOff.Bags {
+		if record, found := byBag[bag]; found {
+			record.Verification = status
+		}
+	}
+
+	return nil
+}
+
+// readReport reads one of erwt's tsv reports into a map for each row keyed by column name, returning no rows if the
+// report does not exist
+func readReport(reportLoc string) ([]map[string]string, error) {
+	report, err := os.Open(reportLoc)
+	if os.IsNotExist(err) {
+		return []map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer report.Close()
+
+	reader := csv.NewReader(report)
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []map[string]string{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", reportLoc, err)
+	}
+
+	rows := []map[string]string{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", reportLoc, err)
+		}
+
+		row := map[string]string{}
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func writeReconcileReport(reportLoc string, records map[string]*reconcileRecord, order []string) error {
+	reportFile, err := os.Create(reportLoc)
+	if err != nil {
+		return err
+	}
+	defer reportFile.Close()
+
+	writer := csv.NewWriter(reportFile)
+	writer.Comma = '\t'
+	writer.Write([]string{"component_id", "title", "in_work_order", "xfer_package", "xfer_prep_error", "transfer_requested", "ingest_completed", "aip_uuid", "aip_store_location", "staged_aip", "prep_status", "delivery_status", "delivered_at", "delivery_verification", "status", "gap"})
+
+	sorted := append([]string{}, order...)
+	sort.SliceStable(sorted, func(i, j int) bool { return records[sorted[i]].InWorkOrder && !records[sorted[j]].InWorkOrder })
+	for _, componentID := range sorted {
+		record := records[componentID]
+		status := "COMPLETE"
+		gap := record.gap()
+		if gap != "" {
+			status = "GAP"
+		}
+		writer.Write([]string{
+			record.ComponentID,
+			record.Title,
+			fmt.Sprint(record.InWorkOrder),
+			record.XferPackage,
+			record.XferPrepError,
+			fmt.Sprint(record.TransferRequested),
+			fmt.Sprint(record.IngestCompleted),
+			record.AIPUUID,
+			record.AIPStoreLoc,
+			record.StagedAIP,
+			record.PrepStatus,
+			record.DeliveryStatus,
+			record.DeliveredAt,
+			record.Verification,
+			status,
+			gap,
+		})
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
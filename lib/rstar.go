@@ -0,0 +1,282 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpBackend uploads bags to R* over sftp
+type sftpBackend struct {
+	ssh       *ssh.Client
+	sftp      *sftp.Client
+	agentConn net.Conn
+}
+
+const defaultSSHPort = "22"
+
+// dialSFTP connects to `rstar-host` over ssh, verifying its host key and authenticating with ssh-agent or a key
+func dialSFTP() (*sftpBackend, error) {
+	if config.RstarHost == "" {
+		return nil, fmt.Errorf("`rstar-host` must be set in config.yml to deliver over sftp")
+	}
+
+	hostKeyCallback, err := getHostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &sftpBackend{}
+	auth, err := client.getAuthMethods()
+	if err != nil {
+		return nil, err
+	}
+
+	username := config.RstarUser
+	if username == "" {
+		currentUser, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		username = currentUser.Username
+	}
+
+	addr := config.RstarHost
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultSSHPort)
+	}
+
+	client.ssh, err = ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("could not connect to %s: %w", addr, err)
+	}
+
+	client.sftp, err = sftp.NewClient(client.ssh, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// getHostKeyCallback verifies the R* host key against a known_hosts file, unknown hosts are rejected
+func getHostKeyCallback() (ssh.HostKeyCallback, error) {
+	knownHostsLoc := config.RstarKnownHosts
+	if knownHostsLoc == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHostsLoc = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(knownHostsLoc)
+	if err != nil {
+		return nil, fmt.Errorf("could not read known hosts file %s: %w", knownHostsLoc, err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return fmt.Errorf("%s is not in %s, add its host key with ssh-keyscan", hostname, knownHostsLoc)
+			}
+			return fmt.Errorf("host key for %s does not match the key in %s", hostname, knownHostsLoc)
+		}
+		return err
+	}, nil
+}
+
+// getAuthMethods uses the keys held by ssh-agent followed by the configured or default private keys
+func (c *sftpBackend) getAuthMethods() ([]ssh.AuthMethod, error) {
+	methods := []ssh.AuthMethod{}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		conn, err := net.Dial("unix", sock)
+		if err == nil {
+			c.agentConn = conn
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	keyLocs := []string{config.RstarSSHKey}
+	if config.RstarSSHKey == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		keyLocs = []string{}
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			keyLocs = append(keyLocs, filepath.Join(home, ".ssh", name))
+		}
+	}
+
+	signers := []ssh.Signer{}
+	for _, keyLoc := range keyLocs {
+		b, err := os.ReadFile(keyLoc)
+		if err != nil {
+			if config.RstarSSHKey != "" {
+				return nil, err
+			}
+			continue
+		}
+
+		signer, err := ssh.ParsePrivateKey(b)
+		if err != nil {
+			var passphraseErr *ssh.PassphraseMissingError
+			if errors.As(err, &passphraseErr) {
+				fmt.Printf("  * [WARNING] %s is passphrase protected, add it to ssh-agent to use it\n", keyLoc)
+				continue
+			}
+			return nil, fmt.Errorf("could not parse ssh key %s: %w", keyLoc, err)
+		}
+		signers = append(signers, signer)
+	}
+
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if len(methods) < 1 {
+		return nil, fmt.Errorf("no ssh-agent or ssh keys available, set `rstar-ssh-key` in config.yml")
+	}
+
+	return methods, nil
+}
+
+func (c *sftpBackend) Name() string { return sftpBackendName }
+
+func (c *sftpBackend) Destination() string {
+	return fmt.Sprintf("%s@%s:%s", c.ssh.User(), c.ssh.RemoteAddr(), config.RstarLoc)
+}
+
+func (c *sftpBackend) Close() error {
+	if c.sftp != nil {
+		c.sftp.Close()
+	}
+	if c.ssh != nil {
+		c.ssh.Close()
+	}
+	if c.agentConn != nil {
+		c.agentConn.Close()
+	}
+	return nil
+}
+
+func (c *sftpBackend) DeliverBag(bag string, numWorkers int) bagDelivery {
+	return deliverFiles(bag, config.RstarLoc, numWorkers, c.sftp.MkdirAll, func(job deliveryJob) deliveryResult {
+		return putWithResume(job, c.remoteSize, c.remoteSum, c.copyFile)
+	})
+}
+
+func (c *sftpBackend) remoteSize(p string) (int64, bool) {
+	info, err := c.sftp.Stat(p)
+	if err != nil {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// remoteSum runs sha256sum on R* for a file already there
+func (c *sftpBackend) remoteSum(p string) (string, error) {
+	sums, err := c.RemoteSHA256([]string{p})
+	if err != nil {
+		return "", err
+	}
+
+	sum, found := sums[p]
+	if !found {
+		return "", fmt.Errorf("no sha256sum for %s", p)
+	}
+	return sum, nil
+}
+
+func (c *sftpBackend) copyFile(job deliveryJob, offset int64) (int64, error) {
+	localFile, err := os.Open(job.LocalPath)
+	if err != nil {
+		return 0, err
+	}
+	defer localFile.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	remoteFile, err := c.sftp.OpenFile(job.RemotePath, flags)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := localFile.Seek(offset, io.SeekStart); err != nil {
+		remoteFile.Close()
+		return 0, err
+	}
+
+	if _, err := remoteFile.Seek(offset, io.SeekStart); err != nil {
+		remoteFile.Close()
+		return 0, err
+	}
+
+	written, err := io.Copy(remoteFile, localFile)
+	if err != nil {
+		remoteFile.Close()
+		return written, err
+	}
+
+	if err := remoteFile.Close(); err != nil {
+		return written, err
+	}
+
+	//check that the copy on R* is complete
+	remoteInfo, err := c.sftp.Stat(job.RemotePath)
+	if err != nil {
+		return written, err
+	}
+
+	if remoteInfo.Size() != job.Size {
+		return written, fmt.Errorf("size mismatch, expected %d bytes, found %d", job.Size, remoteInfo.Size())
+	}
+
+	return written, nil
+}
+
+func (c *sftpBackend) Open(p string) (io.ReadCloser, error) {
+	return c.sftp.Open(p)
+}
+
+func (c *sftpBackend) RemoteSHA256(paths []string) (map[string]string, error) {
+	session, err := c.ssh.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	output, err := session.Output(sha256SumCommand(paths))
+
+	//sha256sum exits with 1 when some of the files could not be read
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == 1 {
+		err = nil
+	}
+
+	return parseSHA256Sum(string(output)), err
+}
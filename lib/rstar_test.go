@@ -0,0 +1,256 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nyudlts/electronic-records-workflow-tool/lib/sftpstub"
+)
+
+// newSFTPStub starts a stand-in R* in-process and points the config at it, authenticating with a fresh client key
+func newSFTPStub(t *testing.T) *sftpstub.Server {
+	t.Helper()
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	dir := t.TempDir()
+	keyLoc := filepath.Join(dir, "id_ed25519")
+	clientKey, err := sftpstub.GenerateClientKey(keyLoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := sftpstub.NewServer(filepath.Join(dir, "root"), clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	knownHostsLoc := filepath.Join(dir, "known_hosts")
+	if err := server.WriteKnownHosts(knownHostsLoc); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := config
+	t.Cleanup(func() { config = previous })
+	config = Config{
+		RstarHost:       server.Addr,
+		RstarUser:       sftpstub.User,
+		RstarLoc:        "aips",
+		RstarSSHKey:     keyLoc,
+		RstarKnownHosts: knownHostsLoc,
+	}
+
+	return server
+}
+
+// writeTestBag writes a bag directory holding numFiles files of distinct content
+func writeTestBag(t *testing.T, numFiles int) string {
+	t.Helper()
+
+	bag := filepath.Join(t.TempDir(), "cc_ER_1-00000000-0000-0000-0000-000000000000")
+	if err := os.MkdirAll(filepath.Join(bag, "data"), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < numFiles; i++ {
+		content := strings.Repeat(fmt.Sprintf("file %d\n", i), 1000+i)
+		if err := os.WriteFile(filepath.Join(bag, "data", fmt.Sprintf("file-%d.txt", i)), []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return bag
+}
+
+// assertDelivered checks that every file in the bag has the same content on the stub
+func assertDelivered(t *testing.T, server *sftpstub.Server, bag string) {
+	t.Helper()
+
+	err := filepath.Walk(bag, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, _ := filepath.Rel(bag, p)
+		want, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		got, err := os.ReadFile(filepath.Join(server.Root, "aips", filepath.Base(bag), rel))
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s does not match the delivered copy", rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialSFTP(t *testing.T) {
+	t.Run("key auth", func(t *testing.T) {
+		newSFTPStub(t)
+
+		backend, err := dialSFTP()
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend.Close()
+	})
+
+	t.Run("unknown client key", func(t *testing.T) {
+		newSFTPStub(t)
+
+		otherKeyLoc := filepath.Join(t.TempDir(), "id_ed25519")
+		if _, err := sftpstub.GenerateClientKey(otherKeyLoc); err != nil {
+			t.Fatal(err)
+		}
+		config.RstarSSHKey = otherKeyLoc
+
+		if backend, err := dialSFTP(); err == nil {
+			backend.Close()
+			t.Fatal("connected with a key the server does not accept")
+		}
+	})
+
+	t.Run("host key mismatch", func(t *testing.T) {
+		newSFTPStub(t)
+
+		//a known_hosts entry for the same address with another server's host key
+		other, err := sftpstub.NewServer(t.TempDir(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other.Addr = config.RstarHost
+		if err := other.WriteKnownHosts(config.RstarKnownHosts); err != nil {
+			t.Fatal(err)
+		}
+
+		backend, err := dialSFTP()
+		if err == nil {
+			backend.Close()
+			t.Fatal("connected to a host whose key does not match known_hosts")
+		}
+		if !strings.Contains(err.Error(), "does not match") {
+			t.Errorf("got %q, want a host key mismatch", err.Error())
+		}
+	})
+
+	t.Run("host not in known_hosts", func(t *testing.T) {
+		newSFTPStub(t)
+
+		if err := os.WriteFile(config.RstarKnownHosts, []byte{}, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		backend, err := dialSFTP()
+		if err == nil {
+			backend.Close()
+			t.Fatal("connected to a host missing from known_hosts")
+		}
+		if !strings.Contains(err.Error(), "is not in") {
+			t.Errorf("got %q, want an unknown host", err.Error())
+		}
+	})
+}
+
+func TestSFTPDeliverBag(t *testing.T) {
+	server := newSFTPStub(t)
+	bag := writeTestBag(t, 20)
+
+	backend, err := dialSFTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	delivery := backend.DeliverBag(bag, 4)
+	if delivery.Err != nil {
+		t.Fatal(delivery.Err)
+	}
+
+	if delivery.NumFiles != 20 || delivery.NumSkipped != 0 {
+		t.Errorf("got %d files delivered and %d skipped, want 20 and 0", delivery.NumFiles, delivery.NumSkipped)
+	}
+	assertDelivered(t, server, bag)
+
+	//a second delivery finds every file already there
+	delivery = backend.DeliverBag(bag, 4)
+	if delivery.Err != nil {
+		t.Fatal(delivery.Err)
+	}
+
+	if delivery.NumSkipped != 20 {
+		t.Errorf("got %d files skipped on redelivery, want 20", delivery.NumSkipped)
+	}
+}
+
+func TestSFTPPutWithResume(t *testing.T) {
+	tests := []struct {
+		name       string
+		remote     func(content []byte) []byte
+		wantStatus string
+		wantOffset int64
+	}{
+		{"truncated remote file", func(content []byte) []byte { return content[:len(content)/2] }, deliveryResumed, -1},
+		{"same size corrupt remote file", func(content []byte) []byte { return bytes.Repeat([]byte("x"), len(content)) }, deliveryTransferred, 0},
+		{"complete remote file", func(content []byte) []byte { return content }, deliverySkipped, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSFTPStub(t)
+			bag := writeTestBag(t, 1)
+
+			localPath := filepath.Join(bag, "data", "file-0.txt")
+			content, err := os.ReadFile(localPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			remote := tt.remote(content)
+			remoteDir := filepath.Join(server.Root, "aips", filepath.Base(bag), "data")
+			if err := os.MkdirAll(remoteDir, 0775); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(remoteDir, "file-0.txt"), remote, 0664); err != nil {
+				t.Fatal(err)
+			}
+
+			backend, err := dialSFTP()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer backend.Close()
+
+			job := deliveryJob{filepath.Base(bag), localPath, joinDestination("aips", filepath.Base(bag), "data/file-0.txt"), int64(len(content))}
+			result := putWithResume(job, backend.remoteSize, backend.remoteSum, backend.copyFile)
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+
+			wantOffset := tt.wantOffset
+			if wantOffset < 0 {
+				wantOffset = int64(len(remote))
+			}
+
+			if result.Status != tt.wantStatus || result.Offset != wantOffset {
+				t.Errorf("got %s from offset %d, want %s from offset %d", result.Status, result.Offset, tt.wantStatus, wantOffset)
+			}
+			assertDelivered(t, server, bag)
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Package sftpstub is a stand-in for the R* SSH server for testing `aip transfer` offline,
+// it accepts a single client key and serves SFTP with relative paths resolved against a local directory.
+package sftpstub
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const User = "rstar"
+
+// Server is a stand-in SSH server with the sftp subsystem and a sha256sum command
+type Server struct {
+	Addr      string
+	Root      string
+	hostKey   ssh.Signer
+	clientKey ssh.PublicKey
+	listener  net.Listener
+}
+
+// NewServer creates a server with a fresh host key that serves files from root to the holder of clientKey
+func NewServer(root string, clientKey ssh.PublicKey) (*Server, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKey, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(root, 0775); err != nil {
+		return nil, err
+	}
+
+	return &Server{Root: root, hostKey: hostKey, clientKey: clientKey}, nil
+}
+
+// GenerateClientKey writes a new unencrypted ed25519 private key to keyLoc and returns its public key
+func GenerateClientKey(keyLoc string) (ssh.PublicKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(private, "erwt sftp stub")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyLoc), 0700); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(keyLoc, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+
+	return ssh.NewPublicKey(public)
+}
+
+// Start listens on addr, e.g. `127.0.0.1:0`, and serves connections in the background
+func (s *Server) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.Addr = listener.Addr().String()
+
+	sshConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == User && string(key.Marshal()) == string(s.clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	sshConfig.AddHostKey(s.hostKey)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveConn(conn, sshConfig)
+		}
+	}()
+
+	return nil
+}
+
+// Close stops accepting connections
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// WriteKnownHosts writes a known_hosts file holding the server's host key
+func (s *Server) WriteKnownHosts(knownHostsLoc string) error {
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.Addr)}, s.hostKey.PublicKey())
+	if err := os.MkdirAll(filepath.Dir(knownHostsLoc), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(knownHostsLoc, []byte(line+"\n"), 0600)
+}
+
+func (s *Server) serveConn(conn net.Conn, sshConfig *ssh.ServerConfig) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, sshConfig)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go s.serveSession(channel, channelRequests)
+	}
+}
+
+// serveSession runs the sftp subsystem or a `sha256sum -- <paths>` exec request, the only command the stub knows
+func (s *Server) serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		payload := struct{ Value string }{}
+		ssh.Unmarshal(req.Payload, &payload)
+
+		switch {
+		case req.Type == "subsystem" && payload.Value == "sftp":
+			req.Reply(true, nil)
+			server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(s.Root))
+			if err != nil {
+				return
+			}
+			if err := server.Serve(); err != nil && err != io.EOF {
+				fmt.Fprintf(os.Stderr, "sftp stub: %s\n", err.Error())
+			}
+			return
+
+		case req.Type == "exec" && strings.HasPrefix(payload.Value, "sha256sum -- "):
+			req.Reply(true, nil)
+			status := s.sha256Sum(channel, strings.TrimPrefix(payload.Value, "sha256sum -- "))
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// sha256Sum writes sha256sum output for the single-quoted paths in args, returning 1 if any could not be read
+func (s *Server) sha256Sum(channel ssh.Channel, args string) uint32 {
+	var status uint32
+	for _, p := range splitQuoted(args) {
+		localPath := p
+		if !filepath.IsAbs(localPath) {
+			localPath = filepath.Join(s.Root, localPath)
+		}
+
+		f, err := os.Open(localPath)
+		if err != nil {
+			fmt.Fprintf(channel.Stderr(), "sha256sum: %s: No such file or directory\n", p)
+			status = 1
+			continue
+		}
+
+		hash := sha256.New()
+		_, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(channel.Stderr(), "sha256sum: %s: %s\n", p, err.Error())
+			status = 1
+			continue
+		}
+
+		fmt.Fprintf(channel, "%s  %s\n", hex.EncodeToString(hash.Sum(nil)), p)
+	}
+	return status
+}
+
+// splitQuoted splits a list of single-quoted shell arguments, such as 'a' 'it'\”s'
+func splitQuoted(args string) []string {
+	paths := []string{}
+	current := &strings.Builder{}
+	inQuote, inArg, escaped := false, false, false
+	for _, r := range args {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\'':
+			inQuote = !inQuote
+			inArg = true
+		case r == '\\' && !inQuote:
+			escaped = true
+			inArg = true
+		case r == ' ' && !inQuote:
+			if inArg {
+				paths = append(paths, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		paths = append(paths, current.String())
+	}
+	return paths
+}
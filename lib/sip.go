@@ -8,26 +8,17 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
-func PrintSIPPackageSize(directories bool) error {
-	fmt.Println("ewt sip size, version", VERSION)
+func PrintSIPPackageSize(opts SizeOptions) error {
+	printSizeHeader("sip", opts)
 	if err := loadConfig(); err != nil {
 		return err
 	}
 
-	if err := getPackageSize(config.SIPLoc); err != nil {
-		return err
-	}
-
-	if directories {
-		if err := printDirectoryStats(config.SIPLoc); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return printPackageSize(config.SIPLoc, opts)
 }
 
 func CleanSip() error {
@@ -66,12 +57,9 @@ func GenerateTransferInfo(profile string) error {
 		return err
 	}
 
+	//the templates directory sits alongside the project directories
 	profileFilename := strings.ToUpper(profile) + ".txt"
-	wd, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-	parentDirectory, _ := filepath.Split(wd)
+	parentDirectory := filepath.Dir(config.ProjectLoc)
 	profileFile := filepath.Join(parentDirectory, "templates", profileFilename)
 
 	if _, err := os.Stat(profileFile); err != nil {
@@ -119,7 +107,7 @@ func ValidateSIP() error {
 	}
 
 	//create a logger
-	logFile, err := os.Create(filepath.Join("logs", fmt.Sprintf("%s-sip-validate.log", config.CollectionCode)))
+	logFile, err := os.Create(currentProject().LogLoc("sip-validate.log"))
 	if err != nil {
 		return err
 	}
@@ -149,7 +137,7 @@ func ValidateSIP() error {
 
 	//check that there is a metadata directory
 	fmt.Print("  2. checking that SIP directory contains a metadata directory: ")
-	mdDirLocation := filepath.Join(config.SIPLoc, "metadata")
+	mdDirLocation := currentProject().Paths().SIPMetadata
 	mdDir, err := os.Stat(mdDirLocation)
 	if err != nil {
 		fmt.Printf("SIP location %s does not contain a metadata directory", config.SIPLoc)
@@ -166,6 +154,15 @@ func ValidateSIP() error {
 	log.Printf("[INFO] %s contains a metadata directory\n", config.SIPLoc)
 	fmt.Println("OK")
 
+	//check that the FTK exports match the contents of the ER directories
+	fmt.Print("  3. checking FTK exports against ER directories: ")
+	if err := checkFTKExports(mdDirLocation); err != nil {
+		fmt.Println("ERROR")
+		log.Printf("[ERROR] %s\n", err.Error())
+		return err
+	}
+	fmt.Println("OK")
+
 	//finish up
 	fmt.Printf("  * Validation report written to %s\n", logFile.Name())
 	return nil
@@ -205,3 +202,52 @@ func ScanAV() error {
 	}
 	return nil
 }
+
+func checkFTKExports(mdDirLocation string) error {
+	exports, err := findFTKExports(mdDirLocation)
+	if err != nil {
+		return err
+	}
+
+	componentIDs := []string{}
+	for componentID := range exports {
+		componentIDs = append(componentIDs, componentID)
+	}
+	sort.Strings(componentIDs)
+
+	failedExports := 0
+	for _, componentID := range componentIDs {
+		exportPath := exports[componentID]
+		erPath := filepath.Join(config.SIPLoc, componentID)
+		if _, err := os.Stat(erPath); err != nil {
+			log.Printf("[WARNING] FTK export %s has no matching ER directory in %s\n", filepath.Base(exportPath), config.SIPLoc)
+			continue
+		}
+
+		report, err := ReconcileFTKExport(exportPath, erPath)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range report.Discrepancies {
+			switch d.Type {
+			case ftkMissing, ftkExtra:
+				log.Printf("[ERROR] %s %s: %s\n", componentID, d.Type, d.Path)
+			default:
+				log.Printf("[ERROR] %s %s: %s, expected %s, found %s\n", componentID, d.Type, d.Path, d.Expected, d.Found)
+			}
+		}
+
+		log.Printf("[INFO] %s: %d of %d files in FTK export matched, %d discrepancies\n", componentID, report.NumMatched, report.NumEntries, len(report.Discrepancies))
+		if len(report.Discrepancies) > 0 {
+			failedExports++
+		}
+	}
+
+	if failedExports > 0 {
+		return fmt.Errorf("%d FTK exports did not match their ER directories", failedExports)
+	}
+
+	log.Printf("[INFO] %d FTK exports matched their ER directories\n", len(componentIDs))
+	return nil
+}
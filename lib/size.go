@@ -1,75 +1,342 @@
 package lib
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/nyudlts/bytemath"
 )
 
-var directories bool
+// SizeOptions holds the settings for the size commands
+type SizeOptions struct {
+	Directories bool
+	Format      string
+	NumLargest  int
+	OutputLoc   string
+}
+
+// SizeReport holds the file counts and sizes of a package
+type SizeReport struct {
+	Path           string           `json:"path"`
+	Size           int64            `json:"size"`
+	NumFiles       int              `json:"num_files"`
+	NumDirectories int              `json:"num_directories"`
+	Extensions     []SizeStats      `json:"extensions"`
+	SizeBuckets    []SizeStats      `json:"size_buckets"`
+	LargestFiles   []FileSize       `json:"largest_files"`
+	Directories    []DirectoryStats `json:"directories,omitempty"`
+	Errors         []WalkError      `json:"errors"`
+}
+
+// SizeStats holds the file count and size of a group of files, by extension or size bucket
+type SizeStats struct {
+	Name     string `json:"name"`
+	NumFiles int    `json:"num_files"`
+	Size     int64  `json:"size"`
+}
+
+type FileSize struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
 
 type DirectoryStats struct {
-	Name           string
-	Size           int64
-	NumFiles       int
-	NumDirectories int
+	Name           string `json:"name"`
+	Size           int64  `json:"size"`
+	NumFiles       int    `json:"num_files"`
+	NumDirectories int    `json:"num_directories"`
 }
 
-func printDirectoryStats(pkgPath string) error {
-	directoryStats := []DirectoryStats{}
-	dirs, err := os.ReadDir(pkgPath)
-	if err != nil {
+// WalkError records an entry that could not be read while walking a package
+type WalkError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ErrUnreadableEntries is returned once a size report listing the entries that could not be read has been written
+var ErrUnreadableEntries = errors.New("entries could not be read")
+
+type sizeBucket struct {
+	Name  string
+	Limit int64
+}
+
+const (
+	kb = int64(1024)
+	mb = 1024 * kb
+	gb = 1024 * mb
+)
+
+// sizeBuckets are upper limits, the last bucket holds everything larger
+var sizeBuckets = []sizeBucket{
+	{"< 1 KB", kb},
+	{"1 KB - 1 MB", mb},
+	{"1 MB - 100 MB", 100 * mb},
+	{"100 MB - 1 GB", gb},
+	{"1 GB - 10 GB", 10 * gb},
+	{">= 10 GB", -1},
+}
+
+func PrintAIPPackageSize(opts SizeOptions) error {
+	printSizeHeader("aip", opts)
+	if err := loadConfig(); err != nil {
 		return err
 	}
 
-	for _, dir := range dirs {
-		ds := DirectoryStats{dir.Name(), 0, 0, 0}
-		if err := filepath.Walk(filepath.Join(pkgPath, dir.Name()), func(path string, info os.FileInfo, err error) error {
-			if info.IsDir() {
-				ds.NumDirectories++
-			} else {
-				ds.NumFiles++
-				ds.Size += info.Size()
+	return printPackageSize(config.AIPLoc, opts)
+}
+
+// printSizeHeader prints the command header, unless the report is being written to stdout as json or csv
+func printSizeHeader(command string, opts SizeOptions) {
+	if opts.OutputLoc != "" || opts.Format == "" || opts.Format == "text" {
+		fmt.Printf("ewt %s size, version %s\n", command, VERSION)
+	}
+}
+
+// printPackageSize reports the file counts and sizes of a package in the format requested
+func printPackageSize(pkgPath string, opts SizeOptions) error {
+	report := getSizeReport(pkgPath, opts.NumLargest, opts.Directories)
+
+	var out io.Writer = os.Stdout
+	if opts.OutputLoc != "" {
+		outFile, err := os.Create(opts.OutputLoc)
+		if err != nil {
+			return err
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+
+	switch opts.Format {
+	case "", "text":
+		writeSizeText(out, report)
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	case "csv":
+		if err := writeSizeCSV(out, report); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %q, expected text, json or csv", opts.Format)
+	}
+
+	if opts.OutputLoc != "" {
+		fmt.Printf("  * size report written to %s\n", opts.OutputLoc)
+	}
+
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d %w in %s", len(report.Errors), ErrUnreadableEntries, pkgPath)
+	}
+
+	return nil
+}
+
+// getSizeReport walks a package, recording the entries it cannot read rather than stopping at them
+func getSizeReport(pkgPath string, numLargest int, directories bool) SizeReport {
+	report := SizeReport{Path: pkgPath, Errors: []WalkError{}, LargestFiles: []FileSize{}}
+	extensions := map[string]*SizeStats{}
+	buckets := make([]SizeStats, len(sizeBuckets))
+	for i, bucket := range sizeBuckets {
+		buckets[i].Name = bucket.Name
+	}
+	topLevel := map[string]*DirectoryStats{}
+
+	filepath.WalkDir(pkgPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			report.Errors = append(report.Errors, WalkError{p, err.Error()})
+			return nil
+		}
+
+		//the first path element below the package, for the per directory stats
+		var dirStats *DirectoryStats
+		if rel, _ := filepath.Rel(pkgPath, p); directories && rel != "." {
+			name := strings.Split(filepath.ToSlash(rel), "/")[0]
+			if _, found := topLevel[name]; !found {
+				topLevel[name] = &DirectoryStats{Name: name}
+			}
+			dirStats = topLevel[name]
+		}
+
+		if d.IsDir() {
+			report.NumDirectories++
+			if dirStats != nil {
+				dirStats.NumDirectories++
 			}
 			return nil
-		}); err != nil {
-			return err
 		}
-		directoryStats = append(directoryStats, ds)
+
+		info, err := d.Info()
+		if err != nil {
+			report.Errors = append(report.Errors, WalkError{p, err.Error()})
+			return nil
+		}
+		size := info.Size()
+
+		report.NumFiles++
+		report.Size += size
+		if dirStats != nil {
+			dirStats.NumFiles++
+			dirStats.Size += size
+		}
+
+		ext := strings.ToLower(filepath.Ext(d.Name()))
+		if ext == "" {
+			ext = "(none)"
+		}
+		if _, found := extensions[ext]; !found {
+			extensions[ext] = &SizeStats{Name: ext}
+		}
+		extensions[ext].NumFiles++
+		extensions[ext].Size += size
+
+		for i, bucket := range sizeBuckets {
+			if bucket.Limit < 0 || size < bucket.Limit {
+				buckets[i].NumFiles++
+				buckets[i].Size += size
+				break
+			}
+		}
+
+		if numLargest > 0 {
+			report.LargestFiles = addLargestFile(report.LargestFiles, FileSize{p, size}, numLargest)
+		}
+		return nil
+	})
+
+	for _, stats := range extensions {
+		report.Extensions = append(report.Extensions, *stats)
 	}
+	sort.Slice(report.Extensions, func(i, j int) bool {
+		return report.Extensions[i].Size > report.Extensions[j].Size
+	})
+	report.SizeBuckets = buckets
 
-	sort.Slice(directoryStats, func(i, j int) bool {
-		return directoryStats[i].Size > directoryStats[j].Size
+	for _, stats := range topLevel {
+		report.Directories = append(report.Directories, *stats)
+	}
+	sort.Slice(report.Directories, func(i, j int) bool {
+		return report.Directories[i].Size > report.Directories[j].Size
 	})
 
-	for _, ds := range directoryStats {
-		fmt.Printf("  * %s: %d files in %d directories, %s\n", ds.Name, ds.NumFiles, ds.NumDirectories, bytemath.ConvertBytesToHumanReadable(ds.Size))
+	return report
+}
+
+// addLargestFile keeps the n largest files, sorted largest first
+func addLargestFile(largest []FileSize, file FileSize, n int) []FileSize {
+	i := sort.Search(len(largest), func(i int) bool { return largest[i].Size < file.Size })
+	if i >= n {
+		return largest
 	}
 
-	return nil
+	largest = append(largest, FileSize{})
+	copy(largest[i+1:], largest[i:])
+	largest[i] = file
+	if len(largest) > n {
+		largest = largest[:n]
+	}
+	return largest
+}
+
+func writeSizeText(out io.Writer, report SizeReport) {
+	fmt.Fprintf(out, "%s: %d files in %d directories, %s\n", report.Path, report.NumFiles, report.NumDirectories, humanReadableSize(report.Size))
+
+	if len(report.Extensions) > 0 {
+		fmt.Fprintln(out, "by extension:")
+		for _, stats := range report.Extensions {
+			fmt.Fprintf(out, "  * %s: %d files, %s\n", stats.Name, stats.NumFiles, humanReadableSize(stats.Size))
+		}
+
+		fmt.Fprintln(out, "by size:")
+		for _, stats := range report.SizeBuckets {
+			fmt.Fprintf(out, "  * %s: %d files, %s\n", stats.Name, stats.NumFiles, humanReadableSize(stats.Size))
+		}
+	}
 
+	if len(report.LargestFiles) > 0 {
+		fmt.Fprintln(out, "largest files:")
+		for _, file := range report.LargestFiles {
+			fmt.Fprintf(out, "  * %s: %s\n", file.Path, humanReadableSize(file.Size))
+		}
+	}
+
+	if len(report.Directories) > 0 {
+		fmt.Fprintln(out, "by directory:")
+		for _, ds := range report.Directories {
+			fmt.Fprintf(out, "  * %s: %d files in %d directories, %s\n", ds.Name, ds.NumFiles, ds.NumDirectories, humanReadableSize(ds.Size))
+		}
+	}
+
+	if len(report.Errors) > 0 {
+		fmt.Fprintln(out, "unreadable entries:")
+		for _, walkErr := range report.Errors {
+			fmt.Fprintf(out, "  * %s: %s\n", walkErr.Path, walkErr.Error)
+		}
+	}
 }
 
-func getPackageSize(pkgPath string) error {
+// writeSizeCSV writes the report as rows of section, name, file count and size in bytes
+func writeSizeCSV(out io.Writer, report SizeReport) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"section", "name", "num_files", "num_directories", "size", "error"})
+	writer.Write([]string{"total", report.Path, strconv.Itoa(report.NumFiles), strconv.Itoa(report.NumDirectories), strconv.FormatInt(report.Size, 10), ""})
+	for _, stats := range report.Extensions {
+		writer.Write([]string{"extension", stats.Name, strconv.Itoa(stats.NumFiles), "", strconv.FormatInt(stats.Size, 10), ""})
+	}
+	for _, stats := range report.SizeBuckets {
+		writer.Write([]string{"size_bucket", stats.Name, strconv.Itoa(stats.NumFiles), "", strconv.FormatInt(stats.Size, 10), ""})
+	}
+	for _, file := range report.LargestFiles {
+		writer.Write([]string{"largest_file", file.Path, "1", "", strconv.FormatInt(file.Size, 10), ""})
+	}
+	for _, ds := range report.Directories {
+		writer.Write([]string{"directory", ds.Name, strconv.Itoa(ds.NumFiles), strconv.Itoa(ds.NumDirectories), strconv.FormatInt(ds.Size, 10), ""})
+	}
+	for _, walkErr := range report.Errors {
+		writer.Write([]string{"error", walkErr.Path, "", "", "", walkErr.Error})
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// humanReadableSize formats a size in bytes, bytemath can not format 0 bytes
+func humanReadableSize(size int64) string {
+	if size == 0 {
+		return "0 B"
+	}
+	return bytemath.ConvertBytesToHumanReadable(size)
+}
+
+func getDirectorySize(pkgPath string) (int, int64, error) {
 	numFiles := 0
-	numDirectories := 0
 	sizeFiles := int64(0)
 
 	if err := filepath.Walk(pkgPath, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			numDirectories++
-		} else {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
 			numFiles++
 			sizeFiles += info.Size()
 		}
 		return nil
 	}); err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	fmt.Printf("%s: %d files in %d directories, %s\n", pkgPath, numFiles, numDirectories, bytemath.ConvertBytesToHumanReadable(sizeFiles))
-	return nil
+	return numFiles, sizeFiles, nil
 }
@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeSizeFiles writes files of the given sizes, keyed by their path below root
+func writeSizeFiles(t *testing.T, root string, files map[string]int) {
+	t.Helper()
+
+	for name, size := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, bytes.Repeat([]byte("x"), size), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetSizeReport(t *testing.T) {
+	root := t.TempDir()
+	writeSizeFiles(t, root, map[string]int{
+		"ER_1/a.txt":        100,
+		"ER_1/b.TXT":        2048,
+		"ER_1/nested/c.pdf": 3000,
+		"ER_2/d":            10,
+	})
+
+	report := getSizeReport(root, 2, true)
+
+	if report.NumFiles != 4 || report.NumDirectories != 4 || report.Size != 5158 {
+		t.Errorf("got %d files in %d directories, %d bytes, want 4 files in 4 directories, 5158 bytes", report.NumFiles, report.NumDirectories, report.Size)
+	}
+
+	wantExtensions := []SizeStats{{".pdf", 1, 3000}, {".txt", 2, 2148}, {"(none)", 1, 10}}
+	if !reflect.DeepEqual(report.Extensions, wantExtensions) {
+		t.Errorf("got extensions %+v, want %+v", report.Extensions, wantExtensions)
+	}
+
+	wantBuckets := []SizeStats{{"< 1 KB", 2, 110}, {"1 KB - 1 MB", 2, 5048}, {"1 MB - 100 MB", 0, 0}, {"100 MB - 1 GB", 0, 0}, {"1 GB - 10 GB", 0, 0}, {">= 10 GB", 0, 0}}
+	if !reflect.DeepEqual(report.SizeBuckets, wantBuckets) {
+		t.Errorf("got size buckets %+v, want %+v", report.SizeBuckets, wantBuckets)
+	}
+
+	wantLargest := []FileSize{{filepath.Join(root, "ER_1", "nested", "c.pdf"), 3000}, {filepath.Join(root, "ER_1", "b.TXT"), 2048}}
+	if !reflect.DeepEqual(report.LargestFiles, wantLargest) {
+		t.Errorf("got largest files %+v, want %+v", report.LargestFiles, wantLargest)
+	}
+
+	wantDirectories := []DirectoryStats{{"ER_1", 5148, 3, 2}, {"ER_2", 10, 1, 1}}
+	if !reflect.DeepEqual(report.Directories, wantDirectories) {
+		t.Errorf("got directories %+v, want %+v", report.Directories, wantDirectories)
+	}
+
+	if len(report.Errors) != 0 {
+		t.Errorf("got errors %+v, want none", report.Errors)
+	}
+}
+
+func TestGetSizeReportUnreadable(t *testing.T) {
+	pkgPath := filepath.Join(t.TempDir(), "missing")
+	report := getSizeReport(pkgPath, 10, false)
+
+	if len(report.Errors) != 1 || report.Errors[0].Path != pkgPath {
+		t.Fatalf("got errors %+v, want %s", report.Errors, pkgPath)
+	}
+
+	//the report is still written before the error is returned
+	outputLoc := filepath.Join(t.TempDir(), "size.json")
+	err := printPackageSize(pkgPath, SizeOptions{Format: "json", OutputLoc: outputLoc})
+	if !errors.Is(err, ErrUnreadableEntries) {
+		t.Fatalf("got %v, want ErrUnreadableEntries", err)
+	}
+
+	b, err := os.ReadFile(outputLoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written := SizeReport{}
+	if err := json.Unmarshal(b, &written); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(written.Errors) != 1 {
+		t.Errorf("got %d errors in the written report, want 1", len(written.Errors))
+	}
+}
+
+func TestAddLargestFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		largest []FileSize
+		file    FileSize
+		want    []FileSize
+	}{
+		{"first file", []FileSize{}, FileSize{"a", 10}, []FileSize{{"a", 10}}},
+		{"larger file goes first", []FileSize{{"a", 10}}, FileSize{"b", 20}, []FileSize{{"b", 20}, {"a", 10}}},
+		{"smaller file goes last", []FileSize{{"a", 10}}, FileSize{"b", 5}, []FileSize{{"a", 10}, {"b", 5}}},
+		{"equal size keeps the earlier file first", []FileSize{{"a", 10}}, FileSize{"b", 10}, []FileSize{{"a", 10}, {"b", 10}}},
+		{"drops the smallest when full", []FileSize{{"a", 30}, {"b", 20}, {"c", 10}}, FileSize{"d", 25}, []FileSize{{"a", 30}, {"d", 25}, {"b", 20}}},
+		{"ignores a smaller file when full", []FileSize{{"a", 30}, {"b", 20}, {"c", 10}}, FileSize{"d", 5}, []FileSize{{"a", 30}, {"b", 20}, {"c", 10}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addLargestFile(tt.largest, tt.file, 3); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteSizeCSV(t *testing.T) {
+	report := SizeReport{
+		Path:           "/sip",
+		Size:           110,
+		NumFiles:       2,
+		NumDirectories: 1,
+		Extensions:     []SizeStats{{".txt", 2, 110}},
+		SizeBuckets:    []SizeStats{{"< 1 KB", 2, 110}},
+		LargestFiles:   []FileSize{{"/sip/a.txt", 100}},
+		Directories:    []DirectoryStats{{"ER_1", 110, 2, 1}},
+		Errors:         []WalkError{{"/sip/b", "permission denied"}},
+	}
+
+	out := &strings.Builder{}
+	if err := writeSizeCSV(out, report); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"section", "name", "num_files", "num_directories", "size", "error"},
+		{"total", "/sip", "2", "1", "110", ""},
+		{"extension", ".txt", "2", "", "110", ""},
+		{"size_bucket", "< 1 KB", "2", "", "110", ""},
+		{"largest_file", "/sip/a.txt", "1", "", "100", ""},
+		{"directory", "ER_1", "2", "1", "110", ""},
+		{"error", "/sip/b", "", "", "", "permission denied"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
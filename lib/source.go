@@ -49,7 +49,7 @@ func TransferSource() error {
 	}
 
 	//check if the metadata director exists
-	mdDirLoc := filepath.Join(config.SIPLoc, "metadata")
+	mdDirLoc := currentProject().Paths().SIPMetadata
 	if _, err := os.Stat(mdDirLoc); err != nil {
 		log.Printf("  * creating metadata directory in %s\n", config.SIPLoc)
 		if err := os.Mkdir(mdDirLoc, 0755); err != nil {
@@ -62,21 +62,11 @@ func TransferSource() error {
 	return nil
 }
 
-func PrintSourcePackageSize(directories bool) error {
-	fmt.Println("ewt source size, version", VERSION)
+func PrintSourcePackageSize(opts SizeOptions) error {
+	printSizeHeader("source", opts)
 	if err := loadConfig(); err != nil {
 		return err
 	}
 
-	if err := getPackageSize(config.SourceLoc); err != nil {
-		return err
-	}
-
-	if directories {
-		if err := printDirectoryStats(config.SourceLoc); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return printPackageSize(config.SourceLoc, opts)
 }
@@ -0,0 +1,414 @@
+package lib
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VerifyDeliveryOptions holds the settings for `aip verify-delivery`
+type VerifyDeliveryOptions struct {
+	AIPLoc         string
+	Backend        string
+	NumWorkers     int
+	RemoteChecksum bool
+}
+
+// deliveryReader is implemented by backends that can read delivered files back
+type deliveryReader interface {
+	Open(p string) (io.ReadCloser, error)
+}
+
+// remoteHasher is implemented by backends that can run sha256sum on the delivery host
+type remoteHasher interface {
+	RemoteSHA256(paths []string) (map[string]string, error)
+}
+
+type fixityCheck struct {
+	Bag        string
+	Path       string
+	Manifest   string
+	RemotePath string
+	Expected   string
+	Found      string
+	Status     string
+}
+
+const (
+	fixityOK       = "OK"
+	fixityMismatch = "MISMATCH"
+	fixityMissing  = "MISSING"
+	fixityError    = "ERROR"
+
+	remoteChecksumBatchSize = 100
+)
+
+func VerifyDelivery(opts VerifyDeliveryOptions) error {
+	fmt.Printf("ewt aip verify-delivery, %s\n", VERSION)
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	if config.RstarLoc == "" {
+		return fmt.Errorf("`rstar-location` must be set in config.yml")
+	}
+
+	aipLoc := firstNonEmpty(opts.AIPLoc, config.AIPLoc, "aips")
+	bags, err := getBags(aipLoc)
+	if err != nil {
+		return err
+	}
+
+	if opts.NumWorkers < 1 {
+		opts.NumWorkers = 1
+	}
+
+	//connect with the backend used for the transfer
+	backend, err := getDeliveryBackend(firstNonEmpty(opts.Backend, config.DeliveryBackend, sftpBackendName))
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	method := "re-read"
+	var checksum func([]fixityCheck) []fixityCheck
+	if opts.RemoteChecksum {
+		hasher, ok := backend.(remoteHasher)
+		if !ok {
+			return fmt.Errorf("the %s backend can not run a remote checksum command", backend.Name())
+		}
+		method = "remote sha256sum"
+		checksum = func(checks []fixityCheck) []fixityCheck { return checkRemoteSHA256(hasher, checks) }
+	} else {
+		reader, ok := backend.(deliveryReader)
+		if !ok {
+			return fmt.Errorf("the %s backend can not read delivered files back", backend.Name())
+		}
+		checksum = func(checks []fixityCheck) []fixityCheck { return checkReadSHA256(reader, checks, opts.NumWorkers) }
+	}
+	fmt.Printf("  * verifying %d bags at %s with %s (%s)\n", len(bags), backend.Destination(), backend.Name(), method)
+
+	//verify each bag against its manifests
+	results := []fixityCheck{}
+	bagStatus := map[string]string{}
+	for _, bag := range bags {
+		bagName := filepath.Base(bag)
+		checks, err := getFixityChecks(bag)
+		if err != nil {
+			fmt.Printf("  * %s: FAILED, %s\n", bagName, err.Error())
+			bagStatus[bagName] = "FAILED"
+			results = append(results, fixityCheck{Bag: bagName, Status: fixityError, Found: err.Error()})
+			continue
+		}
+
+		checks = checksum(checks)
+		failed := 0
+		for _, check := range checks {
+			if check.Status != fixityOK {
+				failed++
+				fmt.Printf("  * [%s] %s/%s: expected %s, found %s\n", check.Status, bagName, check.Path, check.Expected, check.Found)
+			}
+		}
+
+		if failed > 0 {
+			bagStatus[bagName] = "FAILED"
+			fmt.Printf("  * %s: FAILED, %d of %d files did not match\n", bagName, failed, len(checks))
+		} else {
+			bagStatus[bagName] = "OK"
+			fmt.Printf("  * %s: OK, %d files match\n", bagName, len(checks))
+		}
+		results = append(results, checks...)
+	}
+
+	//write the report and sign off on it
+	reportLoc := currentProject().LogLoc("aip-verify-delivery.tsv")
+	if err := writeFixityReport(reportLoc, results); err != nil {
+		return err
+	}
+
+	signOffLoc := currentProject().LogLoc("aip-verify-delivery-signoff.txt")
+	if err := writeSignOff(signOffLoc, reportLoc, backend, method, bags, bagStatus); err != nil {
+		return err
+	}
+	fmt.Printf("  * verification report written to %s, signed off in %s\n", reportLoc, signOffLoc)
+
+	numFailed := 0
+	for _, status := range bagStatus {
+		if status != "OK" {
+			numFailed++
+		}
+	}
+
+	if numFailed > 0 {
+		return fmt.Errorf("%d of %d bags failed verification, do not remove their staging copies", numFailed, len(bags))
+	}
+
+	return nil
+}
+
+// getFixityChecks lists every file in a bag's sha256 manifest and tag manifest, along with the tag manifest itself
+func getFixityChecks(bag string) ([]fixityCheck, error) {
+	bagName := filepath.Base(bag)
+	checks := []fixityCheck{}
+	for _, manifest := range []string{"manifest-sha256.txt", "tagmanifest-sha256.txt"} {
+		entries, err := parseManifest(filepath.Join(bag, manifest))
+		if err != nil {
+			return nil, err
+		}
+
+		paths := []string{}
+		for p := range entries {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+
+		for _, p := range paths {
+			checks = append(checks, fixityCheck{
+				Bag:        bagName,
+				Path:       p,
+				Manifest:   manifest,
+				RemotePath: joinDestination(config.RstarLoc, bagName, p),
+				Expected:   strings.ToLower(entries[p]),
+			})
+		}
+	}
+
+	//the tag manifest is not listed in any manifest, so it is checked against the local copy
+	tagManifest, err := os.Open(filepath.Join(bag, "tagmanifest-sha256.txt"))
+	if err != nil {
+		return nil, err
+	}
+	defer tagManifest.Close()
+
+	sum, err := sha256Sum(tagManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	checks = append(checks, fixityCheck{
+		Bag:        bagName,
+		Path:       "tagmanifest-sha256.txt",
+		Manifest:   "local",
+		RemotePath: joinDestination(config.RstarLoc, bagName, "tagmanifest-sha256.txt"),
+		Expected:   sum,
+	})
+
+	return checks, nil
+}
+
+// parseManifest reads a BagIt manifest into a map of paths to checksums, decoding percent-encoded paths
+func parseManifest(manifestLoc string) (map[string]string, error) {
+	manifest, err := os.Open(manifestLoc)
+	if err != nil {
+		return nil, err
+	}
+	defer manifest.Close()
+
+	decoder := strings.NewReplacer("%0A", "\n", "%0D", "\r", "%25", "%")
+	entries := map[string]string{}
+	scanner := bufio.NewScanner(manifest)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" {
+			return nil, fmt.Errorf("malformed line in %s: %q", manifestLoc, line)
+		}
+
+		p := decoder.Replace(strings.TrimLeft(fields[1], " \t"))
+		entries[filepath.ToSlash(p)] = fields[0]
+	}
+
+	return entries, scanner.Err()
+}
+
+func sha256Sum(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checkReadSHA256 reads each delivered file back through the backend and hashes it locally
+func checkReadSHA256(reader deliveryReader, checks []fixityCheck, numWorkers int) []fixityCheck {
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				checks[i] = readSHA256(reader, checks[i])
+			}
+		}()
+	}
+
+	for i := range checks {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return checks
+}
+
+func readSHA256(reader deliveryReader, check fixityCheck) fixityCheck {
+	f, err := reader.Open(check.RemotePath)
+	if err != nil {
+		check.Status = fixityError
+		if errors.Is(err, fs.ErrNotExist) {
+			check.Status = fixityMissing
+		}
+		check.Found = err.Error()
+		return check
+	}
+	defer f.Close()
+
+	sum, err := sha256Sum(f)
+	if err != nil {
+		check.Status = fixityError
+		check.Found = err.Error()
+		return check
+	}
+
+	return compareFixity(check, sum)
+}
+
+// checkRemoteSHA256 runs sha256sum on the delivery host in batches of files
+func checkRemoteSHA256(hasher remoteHasher, checks []fixityCheck) []fixityCheck {
+	for start := 0; start < len(checks); start += remoteChecksumBatchSize {
+		end := start + remoteChecksumBatchSize
+		if end > len(checks) {
+			end = len(checks)
+		}
+
+		paths := []string{}
+		for _, check := range checks[start:end] {
+			paths = append(paths, check.RemotePath)
+		}
+
+		sums, err := hasher.RemoteSHA256(paths)
+		for i := start; i < end; i++ {
+			sum, ok := sums[checks[i].RemotePath]
+			switch {
+			case ok:
+				checks[i] = compareFixity(checks[i], sum)
+			case err != nil:
+				checks[i].Status = fixityError
+				checks[i].Found = err.Error()
+			default:
+				checks[i].Status = fixityMissing
+			}
+		}
+	}
+
+	return checks
+}
+
+func compareFixity(check fixityCheck, sum string) fixityCheck {
+	check.Found = strings.ToLower(sum)
+	check.Status = fixityOK
+	if check.Found != check.Expected {
+		check.Status = fixityMismatch
+	}
+	return check
+}
+
+// parseSHA256Sum reads the output of sha256sum into a map of paths to checksums
+func parseSHA256Sum(output string) map[string]string {
+	sums := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimRight(line, "\r"), "  ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = fields[0]
+	}
+	return sums
+}
+
+// shellQuote quotes an argument for a remote POSIX shell or rsync's -e, single quotes are put in double quotes as
+// rsync does not treat backslashes as escapes
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+func sha256SumCommand(paths []string) string {
+	quoted := []string{}
+	for _, p := range paths {
+		quoted = append(quoted, shellQuote(p))
+	}
+	return "sha256sum -- " + strings.Join(quoted, " ")
+}
+
+func writeFixityReport(reportLoc string, results []fixityCheck) error {
+	report, err := os.Create(reportLoc)
+	if err != nil {
+		return err
+	}
+	defer report.Close()
+
+	writer := csv.NewWriter(report)
+	writer.Comma = '\t'
+	writer.Write([]string{"bag", "path", "manifest", "remote_path", "expected_sha256", "found_sha256", "status"})
+	for _, r := range results {
+		writer.Write([]string{r.Bag, r.Path, r.Manifest, r.RemotePath, r.Expected, r.Found, r.Status})
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// writeSignOff records who verified the delivery, when and how, with the checksum of the report, and the
+// status of each bag; only bags marked OK here may have their staging copies removed
+func writeSignOff(signOffLoc string, reportLoc string, backend deliveryBackend, method string, bags []string, bagStatus map[string]string) error {
+	report, err := os.Open(reportLoc)
+	if err != nil {
+		return err
+	}
+	defer report.Close()
+
+	reportSum, err := sha256Sum(report)
+	if err != nil {
+		return err
+	}
+
+	operator := "unknown"
+	if currentUser, err := user.Current(); err == nil {
+		operator = currentUser.Username
+	}
+	hostname, _ := os.Hostname()
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "verified-by: %s@%s\n", operator, hostname)
+	fmt.Fprintf(b, "verified-at: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(b, "erwt-version: %s\n", VERSION)
+	fmt.Fprintf(b, "backend: %s\n", backend.Name())
+	fmt.Fprintf(b, "destination: %s\n", backend.Destination())
+	fmt.Fprintf(b, "method: %s\n", method)
+	fmt.Fprintf(b, "report: %s\n", reportLoc)
+	fmt.Fprintf(b, "report-sha256: %s\n", reportSum)
+	fmt.Fprintf(b, "bags:\n")
+	for _, bag := range bags {
+		fmt.Fprintf(b, "  %s: %s\n", filepath.Base(bag), bagStatus[filepath.Base(bag)])
+	}
+
+	return os.WriteFile(signOffLoc, []byte(b.String()), 0664)
+}
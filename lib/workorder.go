@@ -0,0 +1,277 @@
+package lib
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/nyudlts/go-aspace"
+)
+
+const defaultWaypointSize = 200
+
+func AspaceWorkOrder(opts AspaceOptions, matchSIP bool, outputLoc string) error {
+	fmt.Printf("ewt aspace workorder, %s\n", VERSION)
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	//get aspaceConfig
+	if err := getAspaceConfig(opts); err != nil {
+		return err
+	}
+
+	//get transfer info
+	if err := getTransferInfo(); err != nil {
+		return err
+	}
+
+	if outputLoc == "" {
+		outputLoc = filepath.Join(config.SIPLoc, "metadata", fmt.Sprintf("%s_aspace_wo.tsv", config.CollectionCode))
+	}
+
+	if _, err := os.Stat(outputLoc); err == nil {
+		return fmt.Errorf("%s already exists", outputLoc)
+	}
+
+	//generate the work order
+	if err := generateWorkOrder(matchSIP, outputLoc); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func generateWorkOrder(matchSIP bool, outputLoc string) error {
+	client, err := aspace.NewClient(aspaceConfigLoc, aspaceEnv, 20)
+	if err != nil {
+		return err
+	}
+
+	repoID, resourceID, err := aspace.URISplit(transferInfo.ArchivesSpaceResourceURL)
+	if err != nil {
+		return fmt.Errorf("could not parse resource url %s: %w", transferInfo.ArchivesSpaceResourceURL, err)
+	}
+
+	resource, err := client.GetResource(repoID, resourceID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  * walking resource tree for %s: %s\n", resource.URI, resource.Title)
+
+	aoURIs, err := getResourceTreeURIs(client, repoID, resourceID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  * found %d archival objects in resource tree\n", len(aoURIs))
+
+	//get the component ids of the ER directories in the SIP
+	erDirs := map[string]bool{}
+	if matchSIP {
+		entries, err := os.ReadDir(config.SIPLoc)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && entry.Name() != "metadata" {
+				erDirs[entry.Name()] = true
+			}
+		}
+		fmt.Printf("  * matching against %d ER directories in %s\n", len(erDirs), config.SIPLoc)
+	}
+
+	resourceIdentifier := transferInfo.ResourceID
+	if resourceIdentifier == "" {
+		resourceIdentifier = resource.MergeIDs(".")
+	}
+
+	rows := [][]string{}
+	for _, aoURI := range aoURIs {
+		ao, err := client.GetArchivalObjectFromURI(aoURI)
+		if err != nil {
+			return err
+		}
+
+		if ao.ComponentId == "" {
+			continue
+		}
+
+		var selected bool
+		if matchSIP {
+			selected = erDirs[ao.ComponentId]
+		} else {
+			selected, err = hasERDigitalObject(client, ao)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !selected {
+			continue
+		}
+
+		indicators, err := getContainerIndicators(client, ao)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("  * adding %s: %s\n", ao.ComponentId, ao.URI)
+		rows = append(rows, []string{resourceIdentifier, ao.RefID, ao.URI, indicators[0], indicators[1], indicators[2], ao.Title, ao.ComponentId})
+	}
+
+	if len(rows) < 1 {
+		return fmt.Errorf("no archival objects in %s matched", resource.URI)
+	}
+
+	woFile, err := os.Create(outputLoc)
+	if err != nil {
+		return err
+	}
+	defer woFile.Close()
+
+	writer := csv.NewWriter(woFile)
+	writer.Comma = '\t'
+	writer.Write(aspace.HEADER_ROW)
+	writer.WriteAll(rows)
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	fmt.Printf("  * %d rows written to work order %s\n", len(rows), outputLoc)
+	return nil
+}
+
+// getResourceTreeURIs walks the resource tree breadth first, paging through each node's waypoints
+func getResourceTreeURIs(client *aspace.ASClient, repoID int, resourceID int) ([]string, error) {
+	root, err := client.GetRootNode(repoID, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	uris := []string{}
+	queue := []aspace.Node{root}
+	isRoot := true
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		parentURI := node.URI
+		if isRoot {
+			parentURI = ""
+			isRoot = false
+		}
+
+		children, err := getTreeChildren(client, repoID, resourceID, parentURI, node)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range children {
+			uris = append(uris, child.URI)
+			if child.ChildCount > 0 {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	return uris, nil
+}
+
+func getTreeChildren(client *aspace.ASClient, repoID int, resourceID int, parentURI string, node aspace.Node) ([]aspace.Node, error) {
+	waypoints := node.Waypoints
+	if waypoints == 0 && node.ChildCount > 0 {
+		waypointSize := node.WaypointSize
+		if waypointSize == 0 {
+			waypointSize = defaultWaypointSize
+		}
+		waypoints = (node.ChildCount + waypointSize - 1) / waypointSize
+	}
+
+	children := []aspace.Node{}
+	for offset := 0; offset < waypoints; offset++ {
+		endpoint := fmt.Sprintf("/repositories/%d/resources/%d/tree/waypoint?offset=%d&parent_node=%s", repoID, resourceID, offset, url.QueryEscape(parentURI))
+		response, err := client.GetEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		waypoint := []aspace.Node{}
+		if err := json.Unmarshal(body, &waypoint); err != nil {
+			return nil, err
+		}
+		children = append(children, waypoint...)
+	}
+
+	return children, nil
+}
+
+// hasERDigitalObject checks whether an AO has a DO instance for electronic records, either carrying
+// the AO's component id or a file version with the transfer's use statement
+func hasERDigitalObject(client *aspace.ASClient, ao aspace.ArchivalObject) (bool, error) {
+	useStatement := transferInfo.UseStatement
+	if useStatement == "" {
+		useStatement = "electronic-records-reading-room"
+	}
+
+	for _, instance := range ao.Instances {
+		if instance.InstanceType != "digital_object" {
+			continue
+		}
+
+		doURI := instance.DigitalObject["ref"]
+		do, err := client.GetDigitalObjectFromURI(doURI)
+		if err != nil {
+			return false, err
+		}
+
+		if do.DigitalObjectID == ao.ComponentId || do.ContainsUseStatement(useStatement) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func getContainerIndicators(client *aspace.ASClient, ao aspace.ArchivalObject) ([3]string, error) {
+	indicators := [3]string{}
+	for _, instance := range ao.Instances {
+		topContainerURI := instance.SubContainer.TopContainer["ref"]
+		if instance.InstanceType == "digital_object" || topContainerURI == "" {
+			continue
+		}
+
+		response, err := client.GetEndpoint(topContainerURI)
+		if err != nil {
+			return indicators, err
+		}
+
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return indicators, err
+		}
+
+		topContainer := aspace.TopContainer{}
+		if err := json.Unmarshal(body, &topContainer); err != nil {
+			return indicators, err
+		}
+
+		indicators[0] = topContainer.Indicator
+		indicators[1] = instance.SubContainer.Indicator2
+		indicators[2] = instance.SubContainer.Indicator3
+		break
+	}
+
+	return indicators, nil
+}